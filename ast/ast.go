@@ -3,6 +3,7 @@ package ast
 
 import (
 	"monkey/token"
+	"strconv"
 	"strings"
 )
 
@@ -94,6 +95,91 @@ func (ls *AssignmentStatement) String() string {
 	return b.String()
 }
 
+// StructStatement declares a record type with a fixed set of fields and the
+// methods its instances respond to
+type StructStatement struct {
+	Token   token.Token // the token.STRUCT token
+	Name    *Identifier
+	Fields  []*Identifier
+	Methods []*Method
+	Close   token.Token // the token.RBRACE token
+}
+
+func (ss *StructStatement) statementNode()             {}
+func (ss *StructStatement) TokenType() token.TokenType { return ss.Token.Type }
+func (ss *StructStatement) TokenLiteral() string       { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	var b strings.Builder
+
+	fields := []string{}
+	for _, field := range ss.Fields {
+		fields = append(fields, field.String())
+	}
+
+	b.WriteString("struct " + ss.Name.String() + " { ")
+	b.WriteString(strings.Join(fields, ", "))
+	for _, method := range ss.Methods {
+		b.WriteString("; " + method.String())
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
+// Method is a function declared inside a struct, where self is bound to the
+// instance it is called on
+type Method struct {
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (m *Method) String() string {
+	params := []string{}
+	for _, param := range m.Function.Parameters {
+		params = append(params, param.String())
+	}
+	return "fn " + m.Name.String() + "(" + strings.Join(params, ", ") + ") " + m.Function.Body.String()
+}
+
+// ImportStatement evaluates the module found at Path and binds its exported
+// members to Alias
+type ImportStatement struct {
+	Token token.Token // the token.IMPORT token
+	Path  *StringLiteral
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()             {}
+func (is *ImportStatement) TokenType() token.TokenType { return is.Token.Type }
+func (is *ImportStatement) TokenLiteral() string       { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return "import " + strconv.Quote(is.Path.Value) + " as " + is.Alias.String() + ";"
+}
+
+// ExportStatement makes the binding declared by Statement, a let or a struct
+// statement, visible to the files importing the module
+type ExportStatement struct {
+	Token     token.Token // the token.EXPORT token
+	Statement Statement
+}
+
+func (es *ExportStatement) statementNode()             {}
+func (es *ExportStatement) TokenType() token.TokenType { return es.Token.Type }
+func (es *ExportStatement) TokenLiteral() string       { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return "export " + es.Statement.String()
+}
+
+// Name returns the identifier bound by the exported statement
+func (es *ExportStatement) Name() *Identifier {
+	switch stmt := es.Statement.(type) {
+	case *LetStatement:
+		return stmt.Name
+	case *StructStatement:
+		return stmt.Name
+	}
+	return nil
+}
+
 type ReturnStatement struct {
 	Token       token.Token // the token.RETURN token
 	ReturnValue Expression
@@ -128,8 +214,9 @@ func (es *ExpressionStatement) String() string {
 }
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // the token.LBRACE token
 	Statements []Statement
+	Close      token.Token // the token.RBRACE token
 }
 
 func (bs *BlockStatement) statementNode()             {}
@@ -147,6 +234,10 @@ func (bs *BlockStatement) String() string {
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
+
+	// Binding is set by the resolver when the identifier names a local
+	// variable, it stays nil for globals
+	Binding *Binding
 }
 
 func (i *Identifier) expressionNode()            {}
@@ -154,6 +245,13 @@ func (i *Identifier) TokenType() token.TokenType { return i.Token.Type }
 func (i *Identifier) TokenLiteral() string       { return i.Token.Literal }
 func (i *Identifier) String() string             { return i.Value }
 
+// Binding locates a local variable: Slot among the locals of the function
+// Depth functions out from the one referencing it
+type Binding struct {
+	Depth int
+	Slot  int
+}
+
 type IntegerLiteral struct {
 	Token token.Token // the token.INT token
 	Value int64
@@ -185,8 +283,9 @@ func (il *StringLiteral) TokenLiteral() string       { return il.Token.Literal }
 func (il *StringLiteral) String() string             { return il.Token.Literal }
 
 type ArrayLiteral struct {
-	Token    token.Token // the token.INT token
+	Token    token.Token // the token.LBRACKET token
 	Elements []Expression
+	Close    token.Token // the token.RBRACKET token
 }
 
 func (al *ArrayLiteral) expressionNode()            {}
@@ -204,9 +303,37 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+type SetLiteral struct {
+	Token    token.Token // the token.HASHBRACE token
+	Elements []Expression
+	Close    token.Token // the token.RBRACE token
+}
+
+func (sl *SetLiteral) expressionNode()            {}
+func (sl *SetLiteral) TokenType() token.TokenType { return sl.Token.Type }
+func (sl *SetLiteral) TokenLiteral() string       { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out strings.Builder
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// HashPair is a key and value of a HashLiteral
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
 type HashLiteral struct {
-	Token token.Token // the token.INT token
-	Pairs map[Expression]Expression
+	Token token.Token // the token.LBRACE token
+	Pairs []HashPair  // in source order
+	Close token.Token // the token.RBRACE token
 }
 
 func (hl *HashLiteral) expressionNode()            {}
@@ -215,8 +342,8 @@ func (hl *HashLiteral) TokenLiteral() string       { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out strings.Builder
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -225,9 +352,10 @@ func (hl *HashLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token // the token.INT token
+	Token token.Token // the token.LBRACKET token
 	Left  Expression
 	Index Expression
+	Close token.Token // the token.RBRACKET token
 }
 
 func (ie *IndexExpression) expressionNode()            {}
@@ -244,6 +372,41 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is left[start:end:step], where any of the bounds may be nil
+// when omitted
+type SliceExpression struct {
+	Token token.Token // the token.LBRACKET token
+	Left  Expression
+	Start Expression
+	End   Expression
+	Step  Expression
+	Close token.Token // the token.RBRACKET token
+}
+
+func (se *SliceExpression) expressionNode()            {}
+func (se *SliceExpression) TokenType() token.TokenType { return se.Token.Type }
+func (se *SliceExpression) TokenLiteral() string       { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out strings.Builder
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
+	out.WriteString("]")
+	out.WriteString(")")
+	return out.String()
+}
+
 type DotExpression struct {
 	Token token.Token // the token.INT token
 	Left  Expression
@@ -357,6 +520,10 @@ type FunctionLiteral struct {
 	Token      token.Token // the token.IF token
 	Parameters []*Identifier
 	Body       *BlockStatement
+
+	// Locals names the local variables of the function by slot, as set by
+	// the resolver. Methods keep self in the first slot.
+	Locals []string
 }
 
 func (exp *FunctionLiteral) expressionNode()            {}
@@ -379,9 +546,10 @@ func (exp *FunctionLiteral) String() string {
 }
 
 type CallExpression struct {
-	Token     token.Token // the token.IF token
+	Token     token.Token // the token.LPAREN token
 	Function  Expression
 	Arguments []Expression
+	Close     token.Token // the token.RPAREN token
 }
 
 func (exp *CallExpression) expressionNode()            {}
@@ -0,0 +1,147 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Fprint writes node as an indented tree, one node per line with its kind,
+// its values and the position of its token, the children indented below it
+// under the name of their field:
+//
+//	LetStatement @1:1
+//	  Name: Identifier Value="x" @1:5
+//	  Value: IntegerLiteral Value=5 @1:9
+//
+// Nil children and empty lists are left out. The resolver's bindings are not
+// part of the tree.
+func Fprint(w io.Writer, node Node) error {
+	p := &printer{w: w}
+	p.node("", reflect.ValueOf(node), 0)
+	return p.err
+}
+
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(format string, a ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, a...)
+	}
+}
+
+func (p *printer) node(label string, v reflect.Value, depth int) {
+	v = deref(v)
+	p.printf("%s%s%s", strings.Repeat("  ", depth), label, v.Type().Name())
+	for _, f := range fields(v) {
+		if f.kind == valueField {
+			p.printf(" %s=%s", f.name, formatValue(f.value))
+		}
+	}
+	if tok, ok := nodeToken(v); ok && tok.Line > 0 {
+		p.printf(" @%d:%d", tok.Line, tok.Column)
+	}
+	p.printf("\n")
+
+	for _, f := range fields(v) {
+		switch f.kind {
+		case childField:
+			p.node(f.name+": ", f.value, depth+1)
+		case listField:
+			p.printf("%s%s:\n", strings.Repeat("  ", depth+1), f.name)
+			for i := 0; i < f.value.Len(); i++ {
+				p.node("", f.value.Index(i), depth+2)
+			}
+		}
+	}
+}
+
+// FprintJSON writes node as indented JSON, in the form given by the
+// MarshalJSON methods of the nodes
+func FprintJSON(w io.Writer, node Node) error {
+	out, err := json.MarshalIndent(node, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+type fieldKind int
+
+const (
+	valueField fieldKind = iota // a string, number or boolean
+	childField                  // a node
+	listField                   // a list of nodes
+)
+
+type field struct {
+	name  string
+	kind  fieldKind
+	value reflect.Value
+}
+
+// fields lists the fields of a node, leaving out its tokens, what the
+// resolver sets, nil children and empty lists
+func fields(v reflect.Value) []field {
+	out := []field{}
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		value := v.Field(i)
+		switch {
+		case name == "Token" || name == "Close" || name == "Binding" || name == "Locals":
+			continue
+		case value.Kind() == reflect.Slice && value.Len() == 0, isNil(value):
+			continue
+		case value.Kind() == reflect.Slice:
+			out = append(out, field{name, listField, value})
+		case value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer || value.Kind() == reflect.Struct:
+			out = append(out, field{name, childField, value})
+		default:
+			out = append(out, field{name, valueField, value})
+		}
+	}
+	return out
+}
+
+func isNil(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	return false
+}
+
+// deref returns the struct held by an interface or pointer
+func deref(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	return v
+}
+
+// nodeToken returns the token of a node, which the program, methods and
+// hash pairs do not have
+func nodeToken(v reflect.Value) (token.Token, bool) {
+	f := v.FieldByName("Token")
+	if !f.IsValid() {
+		return token.Token{}, false
+	}
+	return f.Interface().(token.Token), true
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return strconv.Quote(v.String())
+	}
+	return fmt.Sprint(v.Interface())
+}
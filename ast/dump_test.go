@@ -0,0 +1,109 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"testing"
+)
+
+// dumpProgram is `let x = -a;` followed by `if (x) { f(1) }`
+func dumpProgram() *Program {
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+				Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5}, Value: "x"},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 1, Column: 9},
+					Operator: "-",
+					Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "a", Line: 1, Column: 10}, Value: "a"},
+				},
+			},
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IF, Literal: "if", Line: 2, Column: 1},
+				Expression: &IfExpression{
+					Token:     token.Token{Type: token.IF, Literal: "if", Line: 2, Column: 1},
+					Condition: &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 2, Column: 5}, Value: "x"},
+					Consequence: &BlockStatement{
+						Token: token.Token{Type: token.LBRACE, Literal: "{", Line: 2, Column: 8},
+						Statements: []Statement{
+							&ExpressionStatement{
+								Token: token.Token{Type: token.IDENT, Literal: "f", Line: 2, Column: 10},
+								Expression: &CallExpression{
+									Token:     token.Token{Type: token.LPAREN, Literal: "(", Line: 2, Column: 11},
+									Function:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "f", Line: 2, Column: 10}, Value: "f"},
+									Arguments: []Expression{&IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Line: 2, Column: 12}, Value: 1}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestFprint(t *testing.T) {
+	expected := `Program
+  Statements:
+    LetStatement @1:1
+      Name: Identifier Value="x" @1:5
+      Value: PrefixExpression Operator="-" @1:9
+        Right: Identifier Value="a" @1:10
+    ExpressionStatement @2:1
+      Expression: IfExpression @2:1
+        Condition: Identifier Value="x" @2:5
+        Consequence: BlockStatement @2:8
+          Statements:
+            ExpressionStatement @2:10
+              Expression: CallExpression @2:11
+                Function: Identifier Value="f" @2:10
+                Arguments:
+                  IntegerLiteral Value=1 @2:12
+`
+	var out bytes.Buffer
+	if err := Fprint(&out, dumpProgram()); err != nil {
+		t.Fatalf("Fprint failed: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong tree.\nwant=%s\ngot=%s", expected, out.String())
+	}
+}
+
+func TestFprintJSON(t *testing.T) {
+	ident := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5}, Value: "x"}
+	ident.Binding = &Binding{Depth: 1, Slot: 2}
+
+	expected := `{
+  "kind": "Identifier",
+  "span": {
+    "start": {
+      "line": 1,
+      "column": 5
+    },
+    "end": {
+      "line": 1,
+      "column": 6
+    }
+  },
+  "token": {
+    "type": "IDENT",
+    "literal": "x",
+    "line": 1,
+    "column": 5
+  },
+  "value": "x",
+  "binding": {
+    "depth": 1,
+    "slot": 2
+  }
+}
+`
+	var out bytes.Buffer
+	if err := FprintJSON(&out, ident); err != nil {
+		t.Fatalf("FprintJSON failed: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot=%s", expected, out.String())
+	}
+}
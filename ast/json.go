@@ -0,0 +1,279 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Nodes marshal to JSON objects holding their kind, the span of their source
+// and their fields named in lower camel case:
+//
+//	{
+//	  "kind": "Identifier",
+//	  "span": {"start": {"line": 1, "column": 5}, "end": {"line": 1, "column": 6}},
+//	  "token": {"type": "IDENT", "literal": "x", "line": 1, "column": 5},
+//	  "value": "x",
+//	  "binding": null
+//	}
+//
+// Every field is written, null for missing nodes, so every node of a kind has
+// the same keys. Methods and the pairs of hash literals are objects with a
+// kind too. The span is derived from the tokens and ignored when unmarshaling.
+
+// kinds holds the types of the objects found in the JSON of a program by kind
+var kinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []any{
+		&Program{}, &LetStatement{}, &AssignmentStatement{}, &StructStatement{},
+		&Method{}, &ImportStatement{}, &ExportStatement{}, &ReturnStatement{},
+		&ExpressionStatement{}, &BlockStatement{}, &Identifier{}, &IntegerLiteral{},
+		&Boolean{}, &StringLiteral{}, &ArrayLiteral{}, &SetLiteral{}, &HashPair{},
+		&HashLiteral{}, &IndexExpression{}, &SliceExpression{}, &DotExpression{},
+		&PrefixExpression{}, &InfixExpression{}, &PostfixExpression{}, &IfExpression{},
+		&FunctionLiteral{}, &CallExpression{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		kinds[t.Name()] = t
+	}
+}
+
+func (p *Program) MarshalJSON() ([]byte, error)              { return marshalNode(p) }
+func (ls *LetStatement) MarshalJSON() ([]byte, error)        { return marshalNode(ls) }
+func (ls *AssignmentStatement) MarshalJSON() ([]byte, error) { return marshalNode(ls) }
+func (ss *StructStatement) MarshalJSON() ([]byte, error)     { return marshalNode(ss) }
+func (is *ImportStatement) MarshalJSON() ([]byte, error)     { return marshalNode(is) }
+func (es *ExportStatement) MarshalJSON() ([]byte, error)     { return marshalNode(es) }
+func (rs *ReturnStatement) MarshalJSON() ([]byte, error)     { return marshalNode(rs) }
+func (es *ExpressionStatement) MarshalJSON() ([]byte, error) { return marshalNode(es) }
+func (bs *BlockStatement) MarshalJSON() ([]byte, error)      { return marshalNode(bs) }
+func (i *Identifier) MarshalJSON() ([]byte, error)           { return marshalNode(i) }
+func (il *IntegerLiteral) MarshalJSON() ([]byte, error)      { return marshalNode(il) }
+func (b *Boolean) MarshalJSON() ([]byte, error)              { return marshalNode(b) }
+func (il *StringLiteral) MarshalJSON() ([]byte, error)       { return marshalNode(il) }
+func (al *ArrayLiteral) MarshalJSON() ([]byte, error)        { return marshalNode(al) }
+func (sl *SetLiteral) MarshalJSON() ([]byte, error)          { return marshalNode(sl) }
+func (hl *HashLiteral) MarshalJSON() ([]byte, error)         { return marshalNode(hl) }
+func (ie *IndexExpression) MarshalJSON() ([]byte, error)     { return marshalNode(ie) }
+func (se *SliceExpression) MarshalJSON() ([]byte, error)     { return marshalNode(se) }
+func (de *DotExpression) MarshalJSON() ([]byte, error)       { return marshalNode(de) }
+func (exp *PrefixExpression) MarshalJSON() ([]byte, error)   { return marshalNode(exp) }
+func (exp *InfixExpression) MarshalJSON() ([]byte, error)    { return marshalNode(exp) }
+func (exp *PostfixExpression) MarshalJSON() ([]byte, error)  { return marshalNode(exp) }
+func (exp *IfExpression) MarshalJSON() ([]byte, error)       { return marshalNode(exp) }
+func (exp *FunctionLiteral) MarshalJSON() ([]byte, error)    { return marshalNode(exp) }
+func (exp *CallExpression) MarshalJSON() ([]byte, error)     { return marshalNode(exp) }
+
+func (p *Program) UnmarshalJSON(data []byte) error              { return unmarshalNode(data, p) }
+func (ls *LetStatement) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, ls) }
+func (ls *AssignmentStatement) UnmarshalJSON(data []byte) error { return unmarshalNode(data, ls) }
+func (ss *StructStatement) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, ss) }
+func (is *ImportStatement) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, is) }
+func (es *ExportStatement) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, es) }
+func (rs *ReturnStatement) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, rs) }
+func (es *ExpressionStatement) UnmarshalJSON(data []byte) error { return unmarshalNode(data, es) }
+func (bs *BlockStatement) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, bs) }
+func (i *Identifier) UnmarshalJSON(data []byte) error           { return unmarshalNode(data, i) }
+func (il *IntegerLiteral) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, il) }
+func (b *Boolean) UnmarshalJSON(data []byte) error              { return unmarshalNode(data, b) }
+func (il *StringLiteral) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, il) }
+func (al *ArrayLiteral) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, al) }
+func (sl *SetLiteral) UnmarshalJSON(data []byte) error          { return unmarshalNode(data, sl) }
+func (hl *HashLiteral) UnmarshalJSON(data []byte) error         { return unmarshalNode(data, hl) }
+func (ie *IndexExpression) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, ie) }
+func (se *SliceExpression) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, se) }
+func (de *DotExpression) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, de) }
+func (exp *PrefixExpression) UnmarshalJSON(data []byte) error   { return unmarshalNode(data, exp) }
+func (exp *InfixExpression) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, exp) }
+func (exp *PostfixExpression) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, exp) }
+func (exp *IfExpression) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, exp) }
+func (exp *FunctionLiteral) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, exp) }
+func (exp *CallExpression) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, exp) }
+
+// Unmarshal decodes a node of any kind from its JSON
+func Unmarshal(data []byte) (Node, error) {
+	v, err := decode(data, reflect.TypeOf((*Node)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	node, _ := v.Interface().(Node)
+	return node, nil
+}
+
+func marshalNode(node any) ([]byte, error) {
+	return json.Marshal(encode(reflect.ValueOf(node)))
+}
+
+func unmarshalNode(data []byte, node any) error {
+	v, err := decodeNode(data, reflect.TypeOf(node).Elem())
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(node).Elem().Set(v.Elem())
+	return nil
+}
+
+// orderedObject is a JSON object keeping its keys in order, encoding/json
+// sorting the keys of maps
+type orderedObject []jsonField
+
+type jsonField struct {
+	key   string
+	value any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, f := range o {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(strconv.Quote(f.key) + ":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+	return []byte(b.String()), nil
+}
+
+// encode converts the value of a field to the values encoding/json writes
+func encode(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return encode(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = encode(v.Index(i))
+		}
+		return list
+	case reflect.Struct:
+		switch value := v.Interface().(type) {
+		case token.Token:
+			return orderedObject{{"type", value.Type}, {"literal", value.Literal}, {"line", value.Line}, {"column", value.Column}}
+		case Binding:
+			return orderedObject{{"depth", value.Depth}, {"slot", value.Slot}}
+		}
+		span := spanOf(v)
+		object := orderedObject{
+			{"kind", v.Type().Name()},
+			{"span", orderedObject{
+				{"start", orderedObject{{"line", span.Start.Line}, {"column", span.Start.Column}}},
+				{"end", orderedObject{{"line", span.End.Line}, {"column", span.End.Column}}},
+			}},
+		}
+		for i := 0; i < v.NumField(); i++ {
+			object = append(object, jsonField{jsonKey(v.Type().Field(i).Name), encode(v.Field(i))})
+		}
+		return object
+	}
+	return v.Interface()
+}
+
+// decode reads a value of type t from its JSON
+func decode(data []byte, t reflect.Type) (reflect.Value, error) {
+	if string(data) == "null" {
+		return reflect.Zero(t), nil
+	}
+
+	switch {
+	case t.Kind() == reflect.Interface:
+		var header struct{ Kind string }
+		if err := json.Unmarshal(data, &header); err != nil {
+			return reflect.Value{}, err
+		}
+		kind, ok := kinds[header.Kind]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown node kind %q", header.Kind)
+		}
+		if !reflect.PointerTo(kind).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("%s is not a valid %s", header.Kind, t.Name())
+		}
+		return decodeNode(data, kind)
+	case t.Kind() == reflect.Pointer && kinds[t.Elem().Name()] == t.Elem():
+		return decodeNode(data, t.Elem())
+	case t.Kind() == reflect.Struct && kinds[t.Name()] == t:
+		node, err := decodeNode(data, t)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return node.Elem(), nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.String:
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return reflect.Value{}, err
+		}
+		out := reflect.MakeSlice(t, len(list), len(list))
+		for i, element := range list {
+			v, err := decode(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Index(i).Set(v)
+		}
+		return out, nil
+	}
+
+	// tokens, bindings and values decode as is, matching their keys to the
+	// fields without regard to case
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// decodeNode reads a node of type t, returning a pointer to it
+func decodeNode(data []byte, t reflect.Type) (reflect.Value, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return reflect.Value{}, err
+	}
+	var kind string
+	if err := json.Unmarshal(object["kind"], &kind); err != nil || kind != t.Name() {
+		return reflect.Value{}, fmt.Errorf("expected kind %s, got %s", t.Name(), object["kind"])
+	}
+	delete(object, "kind")
+	delete(object, "span")
+
+	node := reflect.New(t)
+	for i := 0; i < t.NumField(); i++ {
+		key := jsonKey(t.Field(i).Name)
+		data, ok := object[key]
+		if !ok {
+			continue
+		}
+		delete(object, key)
+		v, err := decode(data, t.Field(i).Type)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s.%s: %w", t.Name(), key, err)
+		}
+		node.Elem().Field(i).Set(v)
+	}
+	for key := range object {
+		return reflect.Value{}, fmt.Errorf("unknown field %q in %s", key, t.Name())
+	}
+	return node, nil
+}
+
+// jsonKey returns the key of a field, its name in lower camel case
+func jsonKey(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
@@ -0,0 +1,105 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolver"
+	"reflect"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `import "lib" as lib;
+export let x = -1 + 2 * 3;
+struct Point { x, y; fn norm() { self.x * self.x } }
+let f = fn(a, b) {
+	let s = "tab\there";
+	if (a > b) { return a[1:2:3]; } else { b = #{a, b}; };
+	[1, true, {"k": a.len()}][0]
+};
+f(1, 2)`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if errors := resolver.New(func(string) bool { return true }).Resolve(program); len(errors) > 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	decoded := &ast.Program{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("decoded program differs.\nwant=%s\ngot=%s", program, decoded)
+	}
+
+	node, err := ast.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if !reflect.DeepEqual(node, ast.Node(program)) {
+		t.Errorf("Unmarshal gave a different program. got=%s", node)
+	}
+
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("marshal of the decoded program failed: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("JSON of the decoded program differs")
+	}
+}
+
+func TestSpanOf(t *testing.T) {
+	input := `let s = "a\"b";
+add(1,
+  [2, 3])`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	tests := []struct {
+		node     ast.Node
+		expected ast.Span
+	}{
+		{program, ast.Span{Start: ast.Position{Line: 1, Column: 1}, End: ast.Position{Line: 3, Column: 10}}},
+		{program.Statements[0], ast.Span{Start: ast.Position{Line: 1, Column: 1}, End: ast.Position{Line: 1, Column: 15}}},
+		{program.Statements[0].(*ast.LetStatement).Value, ast.Span{Start: ast.Position{Line: 1, Column: 9}, End: ast.Position{Line: 1, Column: 15}}},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression, ast.Span{Start: ast.Position{Line: 2, Column: 1}, End: ast.Position{Line: 3, Column: 10}}},
+	}
+	for _, tt := range tests {
+		if span := ast.SpanOf(tt.node); span != tt.expected {
+			t.Errorf("wrong span of %s. want=%+v, got=%+v", tt.node, tt.expected, span)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Unknown"}`, `unknown node kind "Unknown"`},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier"}]}`, `Program.statements: Identifier is not a valid Statement`},
+		{`{"kind": "Identifier", "name": "x"}`, `unknown field "name" in Identifier`},
+		{`{"kind": "LetStatement", "name": {"kind": "Boolean"}}`, `LetStatement.name: expected kind Identifier, got "Boolean"`},
+	}
+	for _, tt := range tests {
+		_, err := ast.Unmarshal([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
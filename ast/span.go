@@ -0,0 +1,83 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+	"strings"
+)
+
+// Position is a place in the source, counting lines and columns from 1.
+// Columns count bytes.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) before(other Position) bool {
+	return p.Line < other.Line || p.Line == other.Line && p.Column < other.Column
+}
+
+// Span covers the source of a node, from its first character up to, but not
+// including, End
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// SpanOf returns the span covered by the tokens of node and of its children,
+// the zero Span for a node built without positions. The parentheses grouping
+// an expression belong to no node, so they are left out of its span.
+func SpanOf(node Node) Span {
+	return spanOf(reflect.ValueOf(node))
+}
+
+func spanOf(v reflect.Value) Span {
+	var s Span
+	s.extend(v)
+	return s
+}
+
+func (s *Span) extend(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if !v.IsNil() {
+			s.extend(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			s.extend(v.Index(i))
+		}
+	case reflect.Struct:
+		if tok, ok := v.Interface().(token.Token); ok {
+			s.add(tokenSpan(tok))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			s.extend(v.Field(i))
+		}
+	}
+}
+
+func (s *Span) add(other Span) {
+	if other.Start.Line == 0 {
+		return
+	}
+	if s.Start.Line == 0 || other.Start.before(s.Start) {
+		s.Start = other.Start
+	}
+	if s.End.before(other.End) {
+		s.End = other.End
+	}
+}
+
+// tokenSpan returns the span of tok in the source. Strings are measured as
+// written with the escapes read by the lexer.
+func tokenSpan(tok token.Token) Span {
+	width := len(tok.Literal)
+	if tok.Type == token.STRING {
+		width += 2 + strings.Count(tok.Literal, "\t") + strings.Count(tok.Literal, "\n") +
+			strings.Count(tok.Literal, "\r") + strings.Count(tok.Literal, `"`)
+	}
+	start := Position{Line: tok.Line, Column: tok.Column}
+	return Span{Start: start, End: Position{Line: tok.Line, Column: tok.Column + width}}
+}
@@ -0,0 +1,262 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is called by Walk for every node. When the visitor
+// w it returns is not nil, Walk visits the children of the node with w, then
+// calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree of node depth first, in the order of the source:
+// it calls v.Visit(node) and walks the children of node with the visitor
+// returned. Methods and the pairs of hash literals are not nodes, their
+// children are walked in their place. Nil children are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		walk(v, n.Name)
+		walk(v, n.Value)
+	case *AssignmentStatement:
+		walk(v, n.Name)
+		walk(v, n.Value)
+	case *StructStatement:
+		walk(v, n.Name)
+		walkIdentifiers(v, n.Fields)
+		for _, method := range n.Methods {
+			walk(v, method.Name)
+			walk(v, method.Function)
+		}
+	case *ImportStatement:
+		walk(v, n.Path)
+		walk(v, n.Alias)
+	case *ExportStatement:
+		walk(v, n.Statement)
+	case *ReturnStatement:
+		walk(v, n.ReturnValue)
+	case *ExpressionStatement:
+		walk(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral:
+		// leaves
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *SetLiteral:
+		walkExpressions(v, n.Elements)
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walk(v, pair.Key)
+			walk(v, pair.Value)
+		}
+	case *IndexExpression:
+		walk(v, n.Left)
+		walk(v, n.Index)
+	case *SliceExpression:
+		walk(v, n.Left)
+		walk(v, n.Start)
+		walk(v, n.End)
+		walk(v, n.Step)
+	case *DotExpression:
+		walk(v, n.Left)
+		walk(v, n.Right)
+	case *PrefixExpression:
+		walk(v, n.Right)
+	case *InfixExpression:
+		walk(v, n.Left)
+		walk(v, n.Right)
+	case *PostfixExpression:
+		walk(v, n.Left)
+	case *IfExpression:
+		walk(v, n.Condition)
+		walk(v, n.Consequence)
+		walk(v, n.Alternative)
+	case *FunctionLiteral:
+		walkIdentifiers(v, n.Parameters)
+		walk(v, n.Body)
+	case *CallExpression:
+		walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", node))
+	}
+
+	v.Visit(nil)
+}
+
+// walk walks node unless it is nil, including a nil pointer held by the
+// interface
+func walk(v Visitor, node Node) {
+	if !isNilNode(node) {
+		Walk(v, node)
+	}
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		walk(v, s)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, exp := range list {
+		walk(v, exp)
+	}
+}
+
+func walkIdentifiers(v Visitor, list []*Identifier) {
+	for _, ident := range list {
+		walk(v, ident)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree of node in the order of Walk, calling f for
+// every node and with nil once the children of a node are done. The children
+// of a node are skipped when f returns false for it.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ModifierFunc returns the node replacing the one it is given, or the same
+// node to keep it
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the tree of node bottom-up: the children of a node are
+// modified before modifier is called with the node itself. It returns the
+// replacement of node. A replacement that cannot take the place of a child,
+// such as a statement returned for an expression, leaves the child as it was.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+	case *LetStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *AssignmentStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *StructStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		modifyIdentifiers(n.Fields, modifier)
+		for _, method := range n.Methods {
+			method.Name = modifyIdentifier(method.Name, modifier)
+			method.Function = modifyChild(method.Function, modifier)
+		}
+	case *ImportStatement:
+		n.Path = modifyChild(n.Path, modifier)
+		n.Alias = modifyIdentifier(n.Alias, modifier)
+	case *ExportStatement:
+		n.Statement = modifyChild(n.Statement, modifier)
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *BlockStatement:
+		modifyStatements(n.Statements, modifier)
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+	case *SetLiteral:
+		modifyExpressions(n.Elements, modifier)
+	case *HashLiteral:
+		for i, pair := range n.Pairs {
+			n.Pairs[i].Key = modifyExpression(pair.Key, modifier)
+			n.Pairs[i].Value = modifyExpression(pair.Value, modifier)
+		}
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *SliceExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Start = modifyExpression(n.Start, modifier)
+		n.End = modifyExpression(n.End, modifier)
+		n.Step = modifyExpression(n.Step, modifier)
+	case *DotExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyIdentifier(n.Right, modifier)
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *PostfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyChild(n.Consequence, modifier)
+		n.Alternative = modifyChild(n.Alternative, modifier)
+	case *FunctionLiteral:
+		modifyIdentifiers(n.Parameters, modifier)
+		n.Body = modifyChild(n.Body, modifier)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+	}
+
+	return modifier(node)
+}
+
+// modifyChild modifies a child of type T, keeping it when it is nil or its
+// replacement is not a T
+func modifyChild[T Node](child T, modifier ModifierFunc) T {
+	if isNilNode(child) {
+		return child
+	}
+	if replacement, ok := Modify(child, modifier).(T); ok {
+		return replacement
+	}
+	return child
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	return modifyChild(exp, modifier)
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	return modifyChild(ident, modifier)
+}
+
+func modifyStatements(list []Statement, modifier ModifierFunc) {
+	for i, s := range list {
+		list[i] = modifyChild(s, modifier)
+	}
+}
+
+func modifyExpressions(list []Expression, modifier ModifierFunc) {
+	for i, exp := range list {
+		list[i] = modifyChild(exp, modifier)
+	}
+}
+
+func modifyIdentifiers(list []*Identifier, modifier ModifierFunc) {
+	for i, ident := range list {
+		list[i] = modifyChild(ident, modifier)
+	}
+}
+
+// isNilNode reports whether node is nil or a nil pointer held by the interface
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
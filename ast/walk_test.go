@@ -0,0 +1,206 @@
+package ast_test
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"testing"
+)
+
+// everyNode parses a program using every kind of node but the postfix
+// expressions, which the parser does not produce
+const everyNode = `import "lib" as lib;
+export let x = -1 + 2;
+struct Point { x; fn getX() { self.x } }
+let f = fn(a) {
+	a = #{a}[0:1:1];
+	if (true) { return "s"; } else { [a, {1: 2}][0] }
+};
+f(1)`
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestInspect(t *testing.T) {
+	program := parseProgram(t, everyNode)
+	program.Statements = append(program.Statements, &ast.ExpressionStatement{
+		Expression: &ast.PostfixExpression{Left: &ast.Identifier{Value: "x"}, Operator: "++"},
+	})
+
+	visited := map[string]int{}
+	depth := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		visited[fmt.Sprintf("%T", node)]++
+		return true
+	})
+	if depth != 0 {
+		t.Errorf("Inspect called f with nil %d times too few", depth)
+	}
+
+	for _, kind := range []string{
+		"*ast.Program", "*ast.LetStatement", "*ast.AssignmentStatement", "*ast.StructStatement",
+		"*ast.ImportStatement", "*ast.ExportStatement", "*ast.ReturnStatement",
+		"*ast.ExpressionStatement", "*ast.BlockStatement", "*ast.Identifier", "*ast.IntegerLiteral",
+		"*ast.Boolean", "*ast.StringLiteral", "*ast.ArrayLiteral", "*ast.SetLiteral",
+		"*ast.HashLiteral", "*ast.IndexExpression", "*ast.SliceExpression", "*ast.DotExpression",
+		"*ast.PrefixExpression", "*ast.InfixExpression", "*ast.PostfixExpression",
+		"*ast.IfExpression", "*ast.FunctionLiteral", "*ast.CallExpression",
+	} {
+		if visited[kind] == 0 {
+			t.Errorf("Inspect did not visit any %s", kind)
+		}
+	}
+	if visited["*ast.IntegerLiteral"] != 9 {
+		t.Errorf("wrong number of integers visited. want=9, got=%d", visited["*ast.IntegerLiteral"])
+	}
+}
+
+func TestInspectOrderAndPruning(t *testing.T) {
+	program := parseProgram(t, `let a = f(1, fn() { 2 }) + b;`)
+
+	identifiers := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.Identifier:
+			identifiers = append(identifiers, node.Value)
+		case *ast.IntegerLiteral:
+			identifiers = append(identifiers, node.String())
+		}
+		return true
+	})
+
+	expected := "[a f 1 b]"
+	if fmt.Sprint(identifiers) != expected {
+		t.Errorf("wrong nodes visited. want=%s, got=%v", expected, identifiers)
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() ast.Expression { return &ast.IntegerLiteral{Token: token.Token{Literal: "1"}, Value: 1} }
+	two := func() ast.Expression { return &ast.IntegerLiteral{Token: token.Token{Literal: "2"}, Value: 2} }
+	turnOneIntoTwo := func(node ast.Node) ast.Node {
+		if integer, ok := node.(*ast.IntegerLiteral); ok && integer.Value == 1 {
+			return two()
+		}
+		return node
+	}
+
+	tests := []struct {
+		input    ast.Node
+		expected string
+	}{
+		{one(), "2"},
+		{&ast.PrefixExpression{Operator: "-", Right: one()}, "(-2)"},
+		{&ast.InfixExpression{Left: one(), Operator: "+", Right: one()}, "(2 + 2)"},
+		{&ast.PostfixExpression{Left: one(), Operator: "++"}, "(2++)"},
+		{&ast.IndexExpression{Left: one(), Index: one()}, "(2[2])"},
+		{&ast.SliceExpression{Left: one(), End: one()}, "(2[:2])"},
+		{&ast.DotExpression{Left: one(), Right: &ast.Identifier{Value: "len"}}, "(2.len)"},
+		{&ast.ArrayLiteral{Elements: []ast.Expression{one(), one()}}, "[2, 2]"},
+		{&ast.SetLiteral{Elements: []ast.Expression{one()}}, "#{2}"},
+		{&ast.HashLiteral{Pairs: []ast.HashPair{{Key: one(), Value: one()}}}, "{2:2}"},
+		{&ast.CallExpression{Function: &ast.Identifier{Value: "f"}, Arguments: []ast.Expression{one()}}, "f(2)"},
+		{&ast.ReturnStatement{Token: token.Token{Literal: "return"}, ReturnValue: one()}, "return 2;"},
+		{&ast.LetStatement{Token: token.Token{Literal: "let"}, Name: &ast.Identifier{Value: "x"}, Value: one()}, "let x = 2;"},
+		{&ast.AssignmentStatement{Name: &ast.Identifier{Value: "x"}, Value: one()}, "x = 2;"},
+		{&ast.ExportStatement{Statement: &ast.LetStatement{Token: token.Token{Literal: "let"}, Name: &ast.Identifier{Value: "x"}, Value: one()}}, "export let x = 2;"},
+		{
+			&ast.IfExpression{
+				Condition:   one(),
+				Consequence: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}},
+				Alternative: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}},
+			},
+			"if2 2 else 2",
+		},
+		{
+			&ast.FunctionLiteral{
+				Parameters: []*ast.Identifier{{Value: "a"}},
+				Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}},
+			},
+			"fn(a) 2",
+		},
+		{
+			&ast.StructStatement{
+				Name: &ast.Identifier{Value: "P"},
+				Methods: []*ast.Method{{
+					Name: &ast.Identifier{Value: "m"},
+					Function: &ast.FunctionLiteral{
+						Body: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}},
+					},
+				}},
+			},
+			"struct P { ; fn m() 2 }",
+		},
+		{&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: one()}}}, "2"},
+	}
+
+	for _, tt := range tests {
+		modified := ast.Modify(tt.input, turnOneIntoTwo)
+		if modified.String() != tt.expected {
+			t.Errorf("wrong modification. want=%q, got=%q", tt.expected, modified.String())
+		}
+	}
+}
+
+func TestModifyIsBottomUp(t *testing.T) {
+	program := parseProgram(t, `1 + 2 * 3`)
+
+	// folding the products first lets the sums fold their results
+	folded := ast.Modify(program, func(node ast.Node) ast.Node {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok {
+			return node
+		}
+		left, leftOk := infix.Left.(*ast.IntegerLiteral)
+		right, rightOk := infix.Right.(*ast.IntegerLiteral)
+		if !leftOk || !rightOk {
+			return node
+		}
+		value := left.Value + right.Value
+		if infix.Operator == "*" {
+			value = left.Value * right.Value
+		}
+		return &ast.IntegerLiteral{Token: token.Token{Literal: fmt.Sprint(value)}, Value: value}
+	})
+
+	if folded.String() != "7" {
+		t.Errorf("wrong folding. want=7, got=%s", folded)
+	}
+}
+
+func TestModifyKeepsMisplacedReplacements(t *testing.T) {
+	let := &ast.LetStatement{
+		Token: token.Token{Literal: "let"},
+		Name:  &ast.Identifier{Value: "x"},
+		Value: &ast.Identifier{Value: "y"},
+	}
+
+	// an identifier cannot be replaced by an integer where only an
+	// identifier fits, the name of the let
+	ast.Modify(let, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.Identifier); ok {
+			return &ast.IntegerLiteral{Token: token.Token{Literal: "5"}, Value: 5}
+		}
+		return node
+	})
+
+	if let.String() != "let x = 5;" {
+		t.Errorf("wrong modification. got=%q", let.String())
+	}
+}
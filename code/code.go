@@ -0,0 +1,277 @@
+// Package code defines the instructions executed by the virtual machine
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of opcodes, each followed by its operands
+// encoded in big endian
+type Instructions []byte
+
+type Opcode byte
+
+// LineTable maps instructions to the lines of source they were compiled
+// from. Each entry covers the instructions from its offset up to the offset
+// of the next one.
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// Line returns the line of the instruction at offset, 0 when unknown
+func (t LineTable) Line(offset int) int {
+	line := 0
+	for _, entry := range t {
+		if entry.Offset > offset {
+			break
+		}
+		line = entry.Line
+	}
+	return line
+}
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpNull
+	OpTrue
+	OpFalse
+
+	// Operators, taking their operands from the stack
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpIn
+	OpNotIn
+	OpUnion
+	OpIntersect
+	OpMinus
+	OpBang
+	OpPrefix // any other prefix operator, named by a string constant
+
+	OpJump
+	OpJumpNotTruthy
+
+	// Variables. Set defines a variable while Assign changes an existing one.
+	OpGetGlobal
+	OpSetGlobal
+	OpAssignGlobal
+	OpGetLocal
+	OpSetLocal
+	OpAssignLocal
+	OpGetFree // a local of an enclosing function, addressed by depth and slot
+	OpAssignFree
+
+	OpArray
+	OpHash
+	OpSet
+	OpIndex
+	OpSlice
+	OpDot
+
+	OpCall
+	OpReturnValue
+	OpClosure
+	OpStruct
+	OpImport
+)
+
+// Slice flags tell which of the bounds of a slice expression were given
+const (
+	SliceStart = 1 << iota
+	SliceEnd
+	SliceStep
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpIn:          {"OpIn", []int{}},
+	OpNotIn:       {"OpNotIn", []int{}},
+	OpUnion:       {"OpUnion", []int{}},
+	OpIntersect:   {"OpIntersect", []int{}},
+	OpMinus:       {"OpMinus", []int{}},
+	OpBang:        {"OpBang", []int{}},
+	OpPrefix:      {"OpPrefix", []int{2}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{1}},
+	OpSetLocal:     {"OpSetLocal", []int{1}},
+	OpAssignLocal:  {"OpAssignLocal", []int{1}},
+	OpGetFree:      {"OpGetFree", []int{1, 1}},
+	OpAssignFree:   {"OpAssignFree", []int{1, 1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpSet:   {"OpSet", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	OpSlice: {"OpSlice", []int{1}},
+	OpDot:   {"OpDot", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpClosure:     {"OpClosure", []int{2}},
+	OpStruct:      {"OpStruct", []int{2}},
+	OpImport:      {"OpImport", []int{2, 2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes op and its operands as an instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def,
+// returning them along with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String disassembles the instructions, one per line prefixed by its offset
+func (ins Instructions) String() string {
+	return ins.disassemble(nil)
+}
+
+// StringWithLines disassembles the instructions like String, adding the line
+// of source of each instruction after its offset, or | when the instruction
+// comes from the same line as the one before
+func (ins Instructions) StringWithLines(lines LineTable) string {
+	if lines == nil {
+		lines = LineTable{}
+	}
+	return ins.disassemble(lines)
+}
+
+func (ins Instructions) disassemble(lines LineTable) string {
+	var out bytes.Buffer
+
+	i, previous := 0, 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			return out.String()
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		if lines == nil {
+			fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		} else {
+			line := fmt.Sprint(lines.Line(i))
+			if i > 0 && lines.Line(i) == lines.Line(previous) {
+				line = "|"
+			}
+			fmt.Fprintf(&out, "%04d %4s %s\n", i, line, ins.fmtInstruction(def, operands))
+		}
+
+		previous = i
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
@@ -0,0 +1,107 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpGetFree, []int{2, 7}, []byte{byte(OpGetFree), 2, 7}},
+		{OpImport, []int{1, 258}, []byte{byte(OpImport), 0, 1, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+			continue
+		}
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpGetFree, 1, 3),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpGetFree 1 3
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestInstructionsStringWithLines(t *testing.T) {
+	instructions := Instructions{}
+	for _, ins := range [][]byte{Make(OpConstant, 0), Make(OpSetGlobal, 0), Make(OpGetGlobal, 0), Make(OpPop)} {
+		instructions = append(instructions, ins...)
+	}
+	lines := LineTable{{Offset: 0, Line: 1}, {Offset: 6, Line: 3}}
+
+	expected := `0000    1 OpConstant 0
+0003    | OpSetGlobal 0
+0006    3 OpGetGlobal 0
+0009    | OpPop
+`
+	if got := instructions.StringWithLines(lines); got != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpSlice, []int{SliceStart | SliceStep}, 1},
+		{OpGetFree, []int{255, 4}, 2},
+		{OpImport, []int{3, 65535}, 4},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"monkey/code"
+	"monkey/object"
+	"sort"
+)
+
+// BytecodeVersion is the version of the instructions and of the format of
+// the files written by MarshalBinary. Changing either means bumping it, so
+// older files are rejected instead of running wrong.
+const BytecodeVersion = 1
+
+// bytecodeMagic starts every bytecode file
+var bytecodeMagic = []byte("MBC\x00")
+
+// A bytecode file holds the magic, the version as a big endian uint16, the
+// CRC-32 of the payload as a big endian uint32 and the payload. Numbers in
+// the payload are varints, strings and lists are prefixed by their length.
+const headerSize = 4 + 2 + 4
+
+// Kinds of constants in the payload
+const (
+	integerConstant byte = iota
+	stringConstant
+	functionConstant
+	structConstant
+)
+
+var (
+	ErrNotBytecode      = errors.New("not a monkey bytecode file")
+	ErrChecksumMismatch = errors.New("bytecode checksum mismatch, the file is corrupted")
+)
+
+// MarshalBinary encodes the bytecode to the format of bytecode files
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	e := &encoder{}
+	e.instructions(b.Instructions, b.Lines)
+	e.strings(b.Globals)
+	e.strings(b.Exports)
+	e.uint(len(b.Constants))
+	for _, constant := range b.Constants {
+		if err := e.constant(constant); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]byte, headerSize, headerSize+len(e.buf))
+	copy(out, bytecodeMagic)
+	binary.BigEndian.PutUint16(out[4:], BytecodeVersion)
+	binary.BigEndian.PutUint32(out[6:], crc32.ChecksumIEEE(e.buf))
+	return append(out, e.buf...), nil
+}
+
+// UnmarshalBinary decodes a bytecode file, rejecting files of another
+// version and corrupted ones
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || !bytes.Equal(data[:4], bytecodeMagic) {
+		return ErrNotBytecode
+	}
+	if version := binary.BigEndian.Uint16(data[4:]); version != BytecodeVersion {
+		return fmt.Errorf("bytecode version %d is not supported, want version %d", version, BytecodeVersion)
+	}
+	payload := data[headerSize:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[6:]) {
+		return ErrChecksumMismatch
+	}
+
+	d := &decoder{buf: payload}
+	decoded := &Bytecode{}
+	decoded.Instructions, decoded.Lines = d.instructions()
+	decoded.Globals = d.strings()
+	decoded.Exports = d.strings()
+	decoded.Constants = make([]object.Object, d.length())
+	for i := range decoded.Constants {
+		decoded.Constants[i] = d.constant()
+	}
+	if d.err == nil && len(d.buf) > 0 {
+		d.err = fmt.Errorf("%d unexpected bytes after the bytecode", len(d.buf))
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if err := decoded.validate(); err != nil {
+		return err
+	}
+
+	*b = *decoded
+	return nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(n int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(n))
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(list []string) {
+	e.uint(len(list))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) instructions(ins code.Instructions, lines code.LineTable) {
+	e.uint(len(ins))
+	e.buf = append(e.buf, ins...)
+	e.uint(len(lines))
+	for _, entry := range lines {
+		e.uint(entry.Offset)
+		e.uint(entry.Line)
+	}
+}
+
+func (e *encoder) function(fn *CompiledFunction) {
+	e.instructions(fn.Instructions, fn.Lines)
+	e.strings(fn.Parameters)
+	e.strings(fn.Locals)
+	e.string(fn.Body)
+}
+
+func (e *encoder) constant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		e.buf = append(e.buf, integerConstant)
+		e.buf = binary.AppendVarint(e.buf, constant.Value)
+	case *object.String:
+		e.buf = append(e.buf, stringConstant)
+		e.string(constant.Value)
+	case *CompiledFunction:
+		e.buf = append(e.buf, functionConstant)
+		e.function(constant)
+	case *object.Struct:
+		e.buf = append(e.buf, structConstant)
+		e.string(constant.Name)
+		e.strings(constant.Fields)
+
+		// methods are written by name so the same program always gives the
+		// same file
+		names := make([]string, 0, len(constant.Methods))
+		for name := range constant.Methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		e.uint(len(names))
+		for _, name := range names {
+			method, ok := constant.Methods[name].(*CompiledFunction)
+			if !ok {
+				return fmt.Errorf("cannot encode method %s of %s", name, constant.Name)
+			}
+			e.string(name)
+			e.function(method)
+		}
+	default:
+		return fmt.Errorf("cannot encode constant %s", constant.Type())
+	}
+	return nil
+}
+
+// decoder reads the payload of a bytecode file. Reads after an error return
+// zero values, the first error being kept in err.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errTruncated = errors.New("bytecode is truncated")
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, read := binary.Uvarint(d.buf)
+	if read <= 0 || n > math.MaxInt32 {
+		d.err = errTruncated
+		return 0
+	}
+	d.buf = d.buf[read:]
+	return int(n)
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, read := binary.Varint(d.buf)
+	if read <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.buf = d.buf[read:]
+	return n
+}
+
+// length reads the length of a list or string, which cannot be longer than
+// the bytes left
+func (d *decoder) length() int {
+	n := d.uint()
+	if n > len(d.buf) {
+		d.err = errTruncated
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	if d.err != nil {
+		return nil
+	}
+	out := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return out
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = errTruncated
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+	list := make([]string, d.length())
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+func (d *decoder) instructions() (code.Instructions, code.LineTable) {
+	ins := code.Instructions(d.bytes())
+	lines := make(code.LineTable, d.length())
+	for i := range lines {
+		lines[i] = code.LineEntry{Offset: d.uint(), Line: d.uint()}
+	}
+	return ins, lines
+}
+
+func (d *decoder) function() *CompiledFunction {
+	fn := &CompiledFunction{}
+	fn.Instructions, fn.Lines = d.instructions()
+	fn.Parameters = d.strings()
+	fn.Locals = d.strings()
+	fn.Body = d.string()
+	return fn
+}
+
+func (d *decoder) constant() object.Object {
+	switch kind := d.byte(); kind {
+	case integerConstant:
+		return &object.Integer{Value: d.int()}
+	case stringConstant:
+		return &object.String{Value: d.string()}
+	case functionConstant:
+		return d.function()
+	case structConstant:
+		template := &object.Struct{Name: d.string(), Fields: d.strings(), Methods: map[string]object.Object{}}
+		methods := d.length()
+		for i := 0; i < methods; i++ {
+			name := d.string()
+			template.Methods[name] = d.function()
+		}
+		return template
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown constant kind %d", kind)
+		}
+		return nil
+	}
+}
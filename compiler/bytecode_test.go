@@ -0,0 +1,297 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+	import "lib.m" as lib;
+	let big = -9223372036854775808;
+	export let greet = fn(name) {
+		"hello " + name
+	};
+	struct Point {
+		x, y
+		fn sum() { self.x + self.y }
+		fn add(other) { Point(self.x + other.x, self.y + other.y) }
+	}
+	-greet("you")[1:]
+	`
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+	again, err := bytecode.MarshalBinary()
+	if err != nil || string(again) != string(data) {
+		t.Errorf("MarshalBinary is not deterministic")
+	}
+
+	decoded := &Bytecode{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+
+	if decoded.Instructions.String() != bytecode.Instructions.String() {
+		t.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s", bytecode.Instructions, decoded.Instructions)
+	}
+	if !reflect.DeepEqual(decoded.Lines, bytecode.Lines) {
+		t.Errorf("wrong lines. want=%v, got=%v", bytecode.Lines, decoded.Lines)
+	}
+	if !reflect.DeepEqual(decoded.Globals, bytecode.Globals) {
+		t.Errorf("wrong globals. want=%v, got=%v", bytecode.Globals, decoded.Globals)
+	}
+	if !reflect.DeepEqual(decoded.Exports, bytecode.Exports) {
+		t.Errorf("wrong exports. want=%v, got=%v", bytecode.Exports, decoded.Exports)
+	}
+	if len(decoded.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bytecode.Constants), len(decoded.Constants))
+	}
+	for i, constant := range bytecode.Constants {
+		if describeConstant(decoded.Constants[i]) != describeConstant(constant) {
+			t.Errorf("constant %d wrong.\nwant=%s\ngot=%s", i,
+				describeConstant(constant), describeConstant(decoded.Constants[i]))
+		}
+	}
+}
+
+// describeConstant prints every part of a constant kept in bytecode files
+func describeConstant(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *CompiledFunction:
+		return fmt.Sprintf("%s%v %v %v %q", constant.Instructions, constant.Lines,
+			constant.Parameters, constant.Locals, constant.Body)
+	case *object.Struct:
+		names := []string{}
+		for name := range constant.Methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out := fmt.Sprintf("struct %s %v", constant.Name, constant.Fields)
+		for _, name := range names {
+			out += "\n" + name + ": " + describeConstant(constant.Methods[name])
+		}
+		return out
+	default:
+		return fmt.Sprintf("%s %s", constant.Type(), constant.Inspect())
+	}
+}
+
+func TestBytecodeRejectsIncompatibleFiles(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(`let a = fn(x) { x + 1 }; a(1)`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	modified := func(change func(data []byte) []byte) []byte {
+		return change(append([]byte{}, data...))
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", []byte{}, "not a monkey bytecode file"},
+		{"source", []byte("let a = 1;\nputs(a);"), "not a monkey bytecode file"},
+		{"version", modified(func(d []byte) []byte {
+			binary.BigEndian.PutUint16(d[4:], BytecodeVersion+1)
+			return d
+		}), "bytecode version 2 is not supported, want version 1"},
+		{"corrupted", modified(func(d []byte) []byte {
+			d[len(d)-1] ^= 0xff
+			return d
+		}), "bytecode checksum mismatch, the file is corrupted"},
+		{"truncated", modified(func(d []byte) []byte {
+			return d[:len(d)-3]
+		}), "bytecode checksum mismatch, the file is corrupted"},
+	}
+
+	for _, tt := range tests {
+		err := (&Bytecode{}).UnmarshalBinary(tt.data)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// TestBytecodeValidationAcceptsCompiledPrograms checks the compiler never
+// produces bytecode its own files would reject
+func TestBytecodeValidationAcceptsCompiledPrograms(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := []string{
+		"let f = fn(x) { let g = fn() { x = x + 1; x }; g(); g() }; f(1)",
+		"let f = fn(x) { if (x) { return 1 }; 2 }; [f(true), f(false)]",
+		`let h = {"a": [1, 2][0:1:1], "b": #{1}}; h["a"][-1:]`,
+		"struct P { x; fn get() { fn() { self.x } } } P(1).get()()",
+		"return 1; 2",
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(src))
+	}
+
+	for _, input := range inputs {
+		comp := New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Errorf("%.40q: compiler error: %s", input, err)
+			continue
+		}
+		data, err := comp.Bytecode().MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %s", err)
+		}
+		if err := (&Bytecode{}).UnmarshalBinary(data); err != nil {
+			t.Errorf("%.40q: compiled bytecode rejected: %s", input, err)
+		}
+	}
+}
+
+func TestBytecodeValidation(t *testing.T) {
+	tests := []struct {
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			&Bytecode{Instructions: code.Instructions{255}},
+			"invalid bytecode at 0000: opcode 255 undefined",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 1)[:2]},
+			"invalid bytecode at 0000: OpConstant is truncated",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 3)},
+			"invalid bytecode at 0000: OpConstant [3] is out of range",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0),
+				Constants:    []object.Object{&object.Integer{Value: 1}},
+			},
+			"invalid bytecode at 0000: OpClosure [0] is out of range",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpSetGlobal, 0),
+			})},
+			"invalid bytecode at 0001: OpSetGlobal [0] is out of range",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			"invalid bytecode at 0000: OpGetLocal [0] is out of range",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 1),
+			}), Constants: []object.Object{&object.Integer{Value: 1}}},
+			"invalid bytecode at 0003: OpJump [1] is not the start of an instruction",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpPop)},
+			"invalid bytecode at 0000: OpPop pops 1 values, the stack holds 0",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpAdd),
+			})},
+			"invalid bytecode at 0001: OpAdd pops 2 values, the stack holds 1",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpCall, 1),
+			})},
+			"invalid bytecode at 0001: OpCall pops 2 values, the stack holds 1",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpArray, 65535)},
+			"invalid bytecode at 0000: OpArray pops 65535 values, the stack holds 0",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpHash, 1),
+			})},
+			"invalid bytecode at 0001: OpHash pops 2 values, the stack holds 1",
+		},
+		{
+			// the paths joining at 0008 leave one value or none
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 8),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJump, 8),
+				code.Make(code.OpNull),
+			})},
+			"invalid bytecode at 0008: stack of 1 values, reached with 0 before",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetFree, 3, 0)},
+			"invalid bytecode at 0000: OpGetFree [3 0] is out of range",
+		},
+		{
+			// closures created by the program have no scope around their own
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0),
+				Constants: []object.Object{&CompiledFunction{
+					Instructions: concatInstructions([]code.Instructions{
+						code.Make(code.OpGetFree, 1, 0),
+						code.Make(code.OpReturnValue),
+					}),
+					Locals: []string{"a"},
+				}},
+			},
+			"invalid bytecode at 0000: OpGetFree [1 0] is out of range",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0),
+				Constants:    []object.Object{&CompiledFunction{Instructions: code.Make(code.OpNull)}},
+			},
+			"invalid bytecode at 0001: function ends without returning",
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := tt.bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %s", err)
+		}
+		err = (&Bytecode{}).UnmarshalBinary(data)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
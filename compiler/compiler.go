@@ -0,0 +1,566 @@
+// Package compiler lowers an ast.Program to bytecode for the virtual machine
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"strings"
+)
+
+// Bytecode is the output of the compiler
+type Bytecode struct {
+	Instructions code.Instructions
+	Lines        code.LineTable
+	Constants    []object.Object
+	Globals      []string // names of the globals by slot
+	Exports      []string // names of the exported globals
+}
+
+// CompiledFunction is the constant emitted for a function literal. Calls
+// store its locals, parameters first, in a scope allocated on the heap so the
+// closures created by the function can share them.
+type CompiledFunction struct {
+	Instructions code.Instructions
+	Lines        code.LineTable
+	Parameters   []string
+	Locals       []string // names of the locals by slot
+	Body         string   // source of the body, for Inspect
+}
+
+func (cf *CompiledFunction) Type() object.ObjectType { return object.CompiledFunctionType }
+func (cf *CompiledFunction) Inspect() string {
+	return "fn(" + strings.Join(cf.Parameters, ", ") + ") {\n" + cf.Body + "\n}"
+}
+
+// infixOperators maps the operators with an instruction of their own
+var infixOperators = map[string]code.Opcode{
+	"+":      code.OpAdd,
+	"-":      code.OpSub,
+	"*":      code.OpMul,
+	"/":      code.OpDiv,
+	"==":     code.OpEqual,
+	"!=":     code.OpNotEqual,
+	"<":      code.OpLessThan,
+	">":      code.OpGreaterThan,
+	"in":     code.OpIn,
+	"not in": code.OpNotIn,
+	"|":      code.OpUnion,
+	"&":      code.OpIntersect,
+}
+
+// maxOperand8 is the largest value of a one byte operand
+const maxOperand8 = 1<<8 - 1
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	exports     []string
+
+	// scopes holds the functions being compiled, the last one being the
+	// innermost
+	scopes []compilationScope
+
+	// err is the first operand found not to fit in its instruction, which
+	// Compile reports once done with the node
+	err error
+}
+
+type compilationScope struct {
+	instructions code.Instructions
+	lines        code.LineTable
+
+	// resolved tells whether the resolver gave the variables of the function
+	// their slots
+	resolved bool
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState creates a compiler that keeps adding to the globals and
+// constants of a previous one, as the REPL compiles each line on its own
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []compilationScope{{}},
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	if s, ok := node.(ast.Statement); ok {
+		c.markLine(s)
+	}
+
+	switch node := node.(type) {
+	case nil:
+		// a missing expression, as in `return;`, evaluates to null
+		c.emit(code.OpNull)
+
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		// the program evaluates to its last statement, which is null unless
+		// it is an expression
+		last := len(node.Statements) - 1
+		if last < 0 || !isExpressionStatement(node.Statements[last]) {
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		return c.compileBlock(node)
+
+	case *ast.LetStatement:
+		// functions may call themselves, so they see their own name
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			symbol := c.symbolTable.Define(node.Name.Value)
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			c.setSymbol(symbol)
+			return nil
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.setSymbol(c.symbolTable.Define(node.Name.Value))
+
+	case *ast.AssignmentStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol, depth, err := c.lookup(node.Name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case symbol.Scope == GlobalScope:
+			c.emit(code.OpAssignGlobal, symbol.Index)
+		case depth == 0:
+			c.emit(code.OpAssignLocal, symbol.Index)
+		default:
+			c.emit(code.OpAssignFree, depth, symbol.Index)
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.StructStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+		template := &object.Struct{Name: node.Name.Value, Methods: map[string]object.Object{}}
+		for _, field := range node.Fields {
+			template.Fields = append(template.Fields, field.Value)
+		}
+		for _, method := range node.Methods {
+			fn, err := c.compileFunction(method.Function, true)
+			if err != nil {
+				return err
+			}
+			template.Methods[method.Name.Value] = fn
+		}
+		c.emit(code.OpStruct, c.addConstant(template))
+		c.setSymbol(symbol)
+
+	case *ast.ImportStatement:
+		path := c.addConstant(&object.String{Value: node.Path.Value})
+		alias := c.addConstant(&object.String{Value: node.Alias.Value})
+		c.emit(code.OpImport, path, alias)
+		c.setSymbol(c.symbolTable.Define(node.Alias.Value))
+
+	case *ast.ExportStatement:
+		if err := c.Compile(node.Statement); err != nil {
+			return err
+		}
+		if len(c.scopes) == 1 {
+			c.exports = append(c.exports, node.Name().Value)
+		}
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.compileExpressions([]ast.Expression{pair.Key, pair.Value}); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs))
+
+	case *ast.SetLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(code.OpSet, len(node.Elements))
+
+	case *ast.Identifier:
+		symbol, depth, err := c.lookup(node)
+		if err != nil {
+			return err
+		}
+		switch {
+		case symbol.Scope == GlobalScope:
+			c.emit(code.OpGetGlobal, symbol.Index)
+		case depth == 0:
+			c.emit(code.OpGetLocal, symbol.Index)
+		default:
+			c.emit(code.OpGetFree, depth, symbol.Index)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			c.emit(code.OpPrefix, c.addConstant(&object.String{Value: node.Operator}))
+		}
+
+	case *ast.InfixExpression:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.compileExpressions([]ast.Expression{node.Left, node.Right}); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 0)
+		if err := c.compileBlock(node.Consequence); err != nil {
+			return err
+		}
+		jump := c.emit(code.OpJump, 0)
+
+		c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBlock(node.Alternative); err != nil {
+			return err
+		}
+		c.changeOperand(jump, len(c.currentInstructions()))
+
+	case *ast.FunctionLiteral:
+		fn, err := c.compileFunction(node, false)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpClosure, c.addConstant(fn))
+
+	case *ast.CallExpression:
+		if len(node.Arguments) > maxOperand8 {
+			return fmt.Errorf("too many arguments in call to %s", node.Function)
+		}
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		if err := c.compileExpressions(node.Arguments); err != nil {
+			return err
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.IndexExpression:
+		if err := c.compileExpressions([]ast.Expression{node.Left, node.Index}); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.SliceExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		flags := 0
+		bounds := []ast.Expression{node.Start, node.End, node.Step}
+		for i, flag := range []int{code.SliceStart, code.SliceEnd, code.SliceStep} {
+			if bounds[i] == nil {
+				continue
+			}
+			if err := c.Compile(bounds[i]); err != nil {
+				return err
+			}
+			flags |= flag
+		}
+		c.emit(code.OpSlice, flags)
+
+	case *ast.DotExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpDot, c.addConstant(&object.String{Value: node.Right.Value}))
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[len(c.scopes)-1].lines,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.Global().Names(),
+		Exports:      c.exports,
+	}
+}
+
+func (c *Compiler) compileExpressions(expressions []ast.Expression) error {
+	for _, exp := range expressions {
+		if err := c.Compile(exp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileBlock leaves the value of block on the stack: the value of its last
+// statement when it is an expression and null otherwise
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	last := len(block.Statements) - 1
+	for i, s := range block.Statements {
+		if i == last && isExpressionStatement(s) {
+			c.markLine(s)
+			return c.Compile(s.(*ast.ExpressionStatement).Expression)
+		}
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+// compileFunction compiles fn in a scope of its own. Methods receive self
+// as their first parameter.
+func (c *Compiler) compileFunction(fn *ast.FunctionLiteral, method bool) (*CompiledFunction, error) {
+	c.enterScope(fn.Locals != nil)
+	// the slots of the resolver put self and the parameters first, as here
+	for _, name := range fn.Locals {
+		c.symbolTable.Define(name)
+	}
+	parameters := []string{}
+	if method {
+		parameters = append(parameters, c.symbolTable.Define("self").Name)
+	}
+	for _, param := range fn.Parameters {
+		parameters = append(parameters, c.symbolTable.Define(param.Value).Name)
+	}
+
+	if err := c.compileBlock(fn.Body); err != nil {
+		return nil, err
+	}
+	c.emit(code.OpReturnValue)
+
+	locals := c.symbolTable.Names()
+	scope := c.leaveScope()
+	if len(locals) > maxOperand8+1 {
+		return nil, fmt.Errorf("too many local variables in %s", fn)
+	}
+
+	return &CompiledFunction{
+		Instructions: scope.instructions,
+		Lines:        scope.lines,
+		Parameters:   parameters,
+		Locals:       locals,
+		Body:         fn.Body.String(),
+	}, nil
+}
+
+// lookup finds the symbol named by ident. Functions checked by the resolver
+// give their identifiers the slot of the local they name, and leave globals
+// unbound.
+func (c *Compiler) lookup(ident *ast.Identifier) (Symbol, int, error) {
+	if ident.Binding != nil {
+		if ident.Binding.Depth > maxOperand8 {
+			return Symbol{}, 0, fmt.Errorf("%s is nested too deeply", ident.Value)
+		}
+		symbol := Symbol{Name: ident.Value, Scope: LocalScope, Index: ident.Binding.Slot}
+		return symbol, ident.Binding.Depth, nil
+	}
+	if c.scopes[len(c.scopes)-1].resolved {
+		global := c.symbolTable.Global()
+		if symbol, _, ok := global.Resolve(ident.Value); ok {
+			return symbol, 0, nil
+		}
+		return global.Define(ident.Value), 0, nil
+	}
+	return c.resolve(ident.Value)
+}
+
+// resolve finds the symbol bound to name along with its depth. Unresolved
+// names are declared as globals, which may be defined later on or fall back
+// to the builtins at run time.
+func (c *Compiler) resolve(name string) (Symbol, int, error) {
+	symbol, depth, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		return c.symbolTable.Global().Define(name), 0, nil
+	}
+	if symbol.Scope == LocalScope && depth > maxOperand8 {
+		return symbol, depth, fmt.Errorf("%s is nested too deeply", name)
+	}
+	return symbol, depth, nil
+}
+
+func (c *Compiler) setSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+// maxOperand16 is the largest value of a two byte operand
+const maxOperand16 = 1<<16 - 1
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	if len(c.constants) > maxOperand16 {
+		c.fail(fmt.Errorf("too many constants, the limit is %d", maxOperand16+1))
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction to the current scope and returns its position
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	scope := &c.scopes[len(c.scopes)-1]
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+	return pos
+}
+
+// markLine records that the instructions emitted next come from the line
+// statement s starts at
+func (c *Compiler) markLine(s ast.Statement) {
+	line := statementLine(s)
+	scope := &c.scopes[len(c.scopes)-1]
+	if line == 0 || scope.lines.Line(len(scope.instructions)) == line {
+		return
+	}
+	entry := code.LineEntry{Offset: len(scope.instructions), Line: line}
+	if last := len(scope.lines) - 1; last >= 0 && scope.lines[last].Offset == entry.Offset {
+		scope.lines[last] = entry
+		return
+	}
+	scope.lines = append(scope.lines, entry)
+}
+
+func (c *Compiler) changeOperand(pos int, operand int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[pos])
+	c.checkOperands(op, []int{operand})
+	copy(ins[pos:], code.Make(op, operand))
+}
+
+// checkOperands records an error for the operands of op too large for their
+// width, which code.Make would truncate
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	for i, operand := range operands {
+		limit := 1<<(8*def.OperandWidths[i]) - 1
+		if operand < 0 || operand > limit {
+			c.fail(fmt.Errorf("operand %d of %s out of range, the limit is %d", operand, def.Name, limit))
+		}
+	}
+}
+
+// fail records err unless an earlier error was recorded
+func (c *Compiler) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[len(c.scopes)-1].instructions
+}
+
+func (c *Compiler) enterScope(resolved bool) {
+	c.scopes = append(c.scopes, compilationScope{instructions: code.Instructions{}, resolved: resolved})
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() compilationScope {
+	scope := c.scopes[len(c.scopes)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = c.symbolTable.Outer
+	return scope
+}
+
+func isExpressionStatement(s ast.Statement) bool {
+	_, ok := s.(*ast.ExpressionStatement)
+	return ok
+}
+
+// statementLine returns the line s starts at, 0 when unknown
+func statementLine(s ast.Statement) int {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token.Line
+	case *ast.AssignmentStatement:
+		return s.Token.Line
+	case *ast.ReturnStatement:
+		return s.Token.Line
+	case *ast.ExpressionStatement:
+		return s.Token.Line
+	case *ast.StructStatement:
+		return s.Token.Line
+	case *ast.ImportStatement:
+		return s.Token.Line
+	case *ast.ExportStatement:
+		return s.Token.Line
+	}
+	return 0
+}
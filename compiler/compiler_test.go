@@ -0,0 +1,440 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `-1; !true; "a" not in "abc"`,
+			expectedConstants: []interface{}{1, "a", "abc"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpNotIn),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2][::1]",
+			expectedConstants: []interface{}{1, 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSlice, code.SliceStep),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `{"a": 1}.a`,
+			expectedConstants: []interface{}{"a", 1, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 1),
+				code.Make(code.OpDot, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { let a = 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 15),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; one = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "len",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `import "lib.m" as lib;`,
+			expectedConstants: []interface{}{"lib.m", "lib"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpImport, 0, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = a; fn() { b = b + 1 } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 1, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpAssignFree, 1, 1),
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpClosure, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn() { return; }; f()",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompiledFunctionLocals(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse("fn(a, b) { let c = a; if (c) { let d = b; } }")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn, ok := comp.Bytecode().Constants[0].(*CompiledFunction)
+	if !ok {
+		t.Fatalf("constant is not CompiledFunction. got=%T", comp.Bytecode().Constants[0])
+	}
+	expected := []string{"a", "b", "c", "d"}
+	if len(fn.Locals) != len(expected) {
+		t.Fatalf("wrong locals. want=%v, got=%v", expected, fn.Locals)
+	}
+	for i, name := range expected {
+		if fn.Locals[i] != name {
+			t.Errorf("local %d wrong. want=%s, got=%s", i, name, fn.Locals[i])
+		}
+	}
+}
+
+func TestLineTables(t *testing.T) {
+	input := `let a = 1;
+
+let f = fn(x) {
+	let y = x;
+	y
+};
+f(a)`
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	expected := code.LineTable{{Offset: 0, Line: 1}, {Offset: 6, Line: 3}, {Offset: 12, Line: 7}}
+	if !reflect.DeepEqual(bytecode.Lines, expected) {
+		t.Errorf("wrong lines. want=%v, got=%v", expected, bytecode.Lines)
+	}
+
+	fn := bytecode.Constants[1].(*CompiledFunction)
+	expected = code.LineTable{{Offset: 0, Line: 4}, {Offset: 4, Line: 5}}
+	if !reflect.DeepEqual(fn.Lines, expected) {
+		t.Errorf("wrong function lines. want=%v, got=%v", expected, fn.Lines)
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("a wrong. got=%+v", a)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a gave a new symbol. got=%+v", again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("b wrong. got=%+v", b)
+	}
+
+	nested := NewEnclosedSymbolTable(local)
+	nested.Define("c")
+
+	tests := []struct {
+		name   string
+		symbol Symbol
+		depth  int
+	}{
+		{"c", Symbol{Name: "c", Scope: LocalScope, Index: 0}, 0},
+		{"b", b, 1},
+		{"a", a, 2},
+	}
+	for _, tt := range tests {
+		symbol, depth, ok := nested.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if symbol != tt.symbol || depth != tt.depth {
+			t.Errorf("%s resolved wrong. want=%+v at %d, got=%+v at %d",
+				tt.name, tt.symbol, tt.depth, symbol, depth)
+		}
+	}
+
+	if _, _, ok := nested.Resolve("d"); ok {
+		t.Errorf("undefined name d resolved")
+	}
+	if nested.Global() != global {
+		t.Errorf("Global() did not return the outermost table")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	comp := New()
+	err := comp.Compile(&ast.PostfixExpression{Left: &ast.Identifier{Value: "a"}, Operator: "++"})
+	if err == nil {
+		t.Fatalf("expected compile error")
+	}
+	if err.Error() != "cannot compile *ast.PostfixExpression" {
+		t.Errorf("wrong error message. got=%q", err)
+	}
+}
+
+func TestOperandOverflows(t *testing.T) {
+	// repeat joins n copies of item, numbered from 0 where it holds %d, or
+	// named with letters where it holds %s as identifiers take no digits
+	repeat := func(item string, sep string, n int) string {
+		items := make([]string, n)
+		for i := range items {
+			switch {
+			case strings.Contains(item, "%d"):
+				items[i] = fmt.Sprintf(item, i)
+			case strings.Contains(item, "%s"):
+				name := ""
+				for j := i; j > 0 || name == ""; j /= 26 {
+					name = string(rune('a'+j%26)) + name
+				}
+				items[i] = fmt.Sprintf(item, name)
+			default:
+				items[i] = item
+			}
+		}
+		return strings.Join(items, sep)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{repeat("%d", "; ", 1<<16+1), "too many constants, the limit is 65536"},
+		{repeat("let v%s = true", "; ", 1<<16+1), "operand 65536 of OpSetGlobal out of range, the limit is 65535"},
+		{"let x = 0; if (true) { " + repeat("x = x + 1", "; ", 12000) + " }",
+			"operand 120014 of OpJumpNotTruthy out of range, the limit is 65535"},
+		{"[" + repeat("true", ", ", 70000) + "]", "operand 70000 of OpArray out of range, the limit is 65535"},
+		{"{" + repeat("true: true", ", ", 1<<16) + "}", "operand 65536 of OpHash out of range, the limit is 65535"},
+		{"#{" + repeat("true", ", ", 1<<16) + "}", "operand 65536 of OpSet out of range, the limit is 65535"},
+	}
+
+	for i, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("tests[%d]: expected compile error", i)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("tests[%d]: wrong error message. want=%q, got=%q", i, tt.expected, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != "" {
+			t.Errorf("%s: %s", tt.input, err)
+		}
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != "" {
+			t.Errorf("%s: %s", tt.input, err)
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) string {
+	concatted := concatInstructions(expected)
+	if concatted.String() != actual.String() {
+		return "wrong instructions.\nwant=\n" + concatted.String() + "got=\n" + actual.String()
+	}
+	return ""
+}
+
+func testConstants(expected []interface{}, actual []object.Object) string {
+	if len(expected) != len(actual) {
+		return "wrong number of constants"
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return "constant " + actual[i].Inspect() + " is not the expected integer"
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return "constant " + actual[i].Inspect() + " is not the expected string"
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*CompiledFunction)
+			if !ok {
+				return "constant " + actual[i].Inspect() + " is not a function"
+			}
+			if err := testInstructions(constant, fn.Instructions); err != "" {
+				return err
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,66 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Disassemble lists the instructions of the program, followed by its
+// constants with the instructions of the functions among them. With lines,
+// every instruction shows the line of source it was compiled from.
+func (b *Bytecode) Disassemble(lines bool) string {
+	var out strings.Builder
+
+	out.WriteString("main:\n")
+	out.WriteString(disassemble(b.Instructions, b.Lines, lines))
+	if len(b.Globals) > 0 {
+		fmt.Fprintf(&out, "globals: %s\n", strings.Join(b.Globals, ", "))
+	}
+	if len(b.Exports) > 0 {
+		fmt.Fprintf(&out, "exports: %s\n", strings.Join(b.Exports, ", "))
+	}
+
+	for i, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *CompiledFunction:
+			fmt.Fprintf(&out, "\nconstant %d: %s\n", i, describeFunction("fn", constant))
+			out.WriteString(disassemble(constant.Instructions, constant.Lines, lines))
+		case *object.Struct:
+			fmt.Fprintf(&out, "\nconstant %d: struct %s { %s }\n", i, constant.Name, strings.Join(constant.Fields, ", "))
+			names := make([]string, 0, len(constant.Methods))
+			for name := range constant.Methods {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				method, ok := constant.Methods[name].(*CompiledFunction)
+				if !ok {
+					continue
+				}
+				fmt.Fprintf(&out, "method %s\n", describeFunction(name, method))
+				out.WriteString(disassemble(method.Instructions, method.Lines, lines))
+			}
+		case *object.String:
+			fmt.Fprintf(&out, "\nconstant %d: %s %s\n", i, constant.Type(), strconv.Quote(constant.Value))
+		default:
+			fmt.Fprintf(&out, "\nconstant %d: %s %s\n", i, constant.Type(), constant.Inspect())
+		}
+	}
+	return out.String()
+}
+
+// describeFunction names a function with its parameters and locals
+func describeFunction(name string, fn *CompiledFunction) string {
+	return fmt.Sprintf("%s(%s) locals: [%s]", name, strings.Join(fn.Parameters, ", "), strings.Join(fn.Locals, ", "))
+}
+
+func disassemble(ins code.Instructions, table code.LineTable, lines bool) string {
+	if lines {
+		return ins.StringWithLines(table)
+	}
+	return ins.String()
+}
@@ -0,0 +1,49 @@
+package compiler
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b
+};
+struct Point { x; fn getX() { self.x } }
+add(1, "2")`
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `main:
+0000    1 OpClosure 0
+0003    | OpSetGlobal 0
+0006    4 OpStruct 2
+0009    | OpSetGlobal 1
+0012    5 OpGetGlobal 0
+0015    | OpConstant 3
+0018    | OpConstant 4
+0021    | OpCall 2
+0023    | OpPop
+globals: add, Point
+
+constant 0: fn(a, b) locals: [a, b]
+0000    2 OpGetLocal 0
+0002    | OpGetLocal 1
+0004    | OpAdd
+0005    | OpReturnValue
+
+constant 1: STRING "x"
+
+constant 2: struct Point { x }
+method getX(self) locals: [self]
+0000    4 OpGetLocal 0
+0002    | OpDot 1
+0005    | OpReturnValue
+
+constant 3: INTEGER 1
+
+constant 4: STRING "2"
+`
+	if got := comp.Bytecode().Disassemble(true); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%s\ngot=%s", expected, got)
+	}
+}
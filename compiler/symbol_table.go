@@ -0,0 +1,79 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+)
+
+// Symbol is a variable and the slot holding its value, among the globals or
+// the locals of the function declaring it
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable holds the variables declared by a function, or by the program
+// itself for the outermost table. Blocks do not open tables of their own, as
+// they share the environment of their function in the evaluator.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol
+	names []string
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define declares name in this table. Declaring a name twice returns the
+// symbol of the first declaration, as a second let overwrites the first.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: len(s.names)}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	return symbol
+}
+
+// Resolve looks name up in this table and its outer ones. For locals it also
+// returns how many functions out from this one the name was declared.
+func (s *SymbolTable) Resolve(name string) (Symbol, int, bool) {
+	depth := 0
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol, depth, true
+		}
+		depth++
+	}
+	return Symbol{}, 0, false
+}
+
+// Global returns the outermost table, holding the globals
+func (s *SymbolTable) Global() *SymbolTable {
+	table := s
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	return table
+}
+
+// Names lists the declared names by slot
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
@@ -0,0 +1,269 @@
+package compiler
+
+import (
+	"fmt"
+	"math/bits"
+	"monkey/code"
+	"monkey/object"
+	"sort"
+)
+
+// instruction is an instruction of a decoded file along with its operands
+type instruction struct {
+	def      *code.Definition
+	op       code.Opcode
+	operands []int
+	width    int // of the instruction with its operands
+}
+
+// validate checks the instructions of a decoded file the way the machine
+// runs them, so a file built by hand cannot crash it. Instructions must only
+// refer to the constants, globals and locals the file holds, jump to the
+// start of an instruction, find on the stack the values they pop and reach
+// the scopes of the free variables they read. Functions must return rather
+// than run out of instructions.
+func (b *Bytecode) validate() error {
+	// main stands for the program, whose frame has no scope
+	main := &CompiledFunction{Instructions: b.Instructions}
+	bodies := []*CompiledFunction{main}
+	for _, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *CompiledFunction:
+			bodies = append(bodies, constant)
+		case *object.Struct:
+			names := make([]string, 0, len(constant.Methods))
+			for name := range constant.Methods {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				bodies = append(bodies, constant.Methods[name].(*CompiledFunction))
+			}
+		}
+	}
+
+	// creators lists for each function the bodies creating closures of it,
+	// whose scopes the closures see as their outer scope
+	decoded := map[*CompiledFunction]map[int]instruction{}
+	creators := map[*CompiledFunction][]*CompiledFunction{}
+	for _, fn := range bodies {
+		instructions, err := b.decodeInstructions(fn)
+		if err != nil {
+			return err
+		}
+		decoded[fn] = instructions
+		for _, ins := range instructions {
+			switch ins.op {
+			case code.OpClosure:
+				created := b.Constants[ins.operands[0]].(*CompiledFunction)
+				creators[created] = append(creators[created], fn)
+			case code.OpStruct:
+				for _, method := range b.Constants[ins.operands[0]].(*object.Struct).Methods {
+					created := method.(*CompiledFunction)
+					creators[created] = append(creators[created], fn)
+				}
+			}
+		}
+	}
+
+	for _, fn := range bodies {
+		for _, ip := range sortedOffsets(decoded[fn]) {
+			ins := decoded[fn][ip]
+			if ins.op != code.OpGetFree && ins.op != code.OpAssignFree {
+				continue
+			}
+			if !hasFree(fn, main, creators, ins.operands[0], ins.operands[1]) {
+				return fmt.Errorf("invalid bytecode at %04d: %s %v is out of range", ip, ins.def.Name, ins.operands)
+			}
+		}
+		if err := validateStack(fn, decoded[fn], fn == main); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeInstructions decodes the instructions of fn by offset, checking
+// their operands
+func (b *Bytecode) decodeInstructions(fn *CompiledFunction) (map[int]instruction, error) {
+	ins := fn.Instructions
+	decoded := map[int]instruction{}
+
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytecode at %04d: %s", ip, err)
+		}
+		width := 1
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if ip+width > len(ins) {
+			return nil, fmt.Errorf("invalid bytecode at %04d: %s is truncated", ip, def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[ip+1:])
+
+		valid := true
+		switch code.Opcode(ins[ip]) {
+		case code.OpConstant:
+			valid = operands[0] < len(b.Constants)
+		case code.OpPrefix, code.OpDot:
+			valid = b.isConstant(operands[0], object.StringType)
+		case code.OpImport:
+			valid = b.isConstant(operands[0], object.StringType) && b.isConstant(operands[1], object.StringType)
+		case code.OpClosure:
+			valid = b.isConstant(operands[0], object.CompiledFunctionType)
+		case code.OpStruct:
+			valid = b.isConstant(operands[0], object.StructType)
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			valid = operands[0] < len(b.Globals)
+		case code.OpGetLocal, code.OpSetLocal, code.OpAssignLocal:
+			valid = operands[0] < len(fn.Locals)
+		case code.OpJump, code.OpJumpNotTruthy:
+			valid = operands[0] <= len(ins)
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid bytecode at %04d: %s %v is out of range", ip, def.Name, operands)
+		}
+		decoded[ip] = instruction{def: def, op: code.Opcode(ins[ip]), operands: operands, width: width}
+		ip += width
+	}
+
+	for _, ip := range sortedOffsets(decoded) {
+		ins := decoded[ip]
+		if ins.op != code.OpJump && ins.op != code.OpJumpNotTruthy {
+			continue
+		}
+		if _, ok := decoded[ins.operands[0]]; !ok && ins.operands[0] != len(fn.Instructions) {
+			return nil, fmt.Errorf("invalid bytecode at %04d: %s %v is not the start of an instruction",
+				ip, ins.def.Name, ins.operands)
+		}
+	}
+	return decoded, nil
+}
+
+func (b *Bytecode) isConstant(index int, t object.ObjectType) bool {
+	return index < len(b.Constants) && b.Constants[index].Type() == t
+}
+
+// hasFree reports whether every scope found depth levels out from a call of
+// fn holds slot. The program has no scope, so neither it nor the functions
+// it creates have anything that far out.
+func hasFree(fn, main *CompiledFunction, creators map[*CompiledFunction][]*CompiledFunction, depth, slot int) bool {
+	level := []*CompiledFunction{fn}
+	for ; depth > 0; depth-- {
+		seen := map[*CompiledFunction]bool{}
+		outer := []*CompiledFunction{}
+		for _, f := range level {
+			if f == main {
+				return false
+			}
+			for _, creator := range creators[f] {
+				if !seen[creator] {
+					seen[creator] = true
+					outer = append(outer, creator)
+				}
+			}
+		}
+		level = outer
+	}
+
+	for _, f := range level {
+		if f == main || slot >= len(f.Locals) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateStack follows every path through the instructions of fn, checking
+// that the stack holds the values each instruction pops and has the same
+// depth whichever path reaches an instruction
+func validateStack(fn *CompiledFunction, decoded map[int]instruction, main bool) error {
+	depths := map[int]int{0: 0}
+	pending := []int{0}
+	for len(pending) > 0 {
+		ip := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if ip == len(fn.Instructions) {
+			// only the program ends without returning
+			if !main {
+				return fmt.Errorf("invalid bytecode at %04d: function ends without returning", ip)
+			}
+			continue
+		}
+
+		ins := decoded[ip]
+		pops, pushes := stackEffect(ins)
+		depth := depths[ip]
+		if depth < pops {
+			return fmt.Errorf("invalid bytecode at %04d: %s pops %d values, the stack holds %d",
+				ip, ins.def.Name, pops, depth)
+		}
+		depth += pushes - pops
+
+		next := []int{ip + ins.width}
+		switch ins.op {
+		case code.OpReturnValue:
+			next = nil
+		case code.OpJump:
+			next = []int{ins.operands[0]}
+		case code.OpJumpNotTruthy:
+			next = append(next, ins.operands[0])
+		}
+		for _, target := range next {
+			if reached, ok := depths[target]; ok {
+				if reached != depth {
+					return fmt.Errorf("invalid bytecode at %04d: stack of %d values, reached with %d before",
+						target, depth, reached)
+				}
+				continue
+			}
+			depths[target] = depth
+			pending = append(pending, target)
+		}
+	}
+	return nil
+}
+
+// stackEffect returns the number of values ins pops from the stack and the
+// number it pushes
+func stackEffect(ins instruction) (pops, pushes int) {
+	switch ins.op {
+	case code.OpConstant, code.OpNull, code.OpTrue, code.OpFalse, code.OpGetGlobal, code.OpGetLocal,
+		code.OpGetFree, code.OpClosure, code.OpStruct, code.OpImport:
+		return 0, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpAssignGlobal, code.OpSetLocal,
+		code.OpAssignLocal, code.OpAssignFree, code.OpReturnValue:
+		return 1, 0
+	case code.OpJump:
+		return 0, 0
+	case code.OpMinus, code.OpBang, code.OpPrefix, code.OpDot:
+		return 1, 1
+	case code.OpArray, code.OpSet:
+		return ins.operands[0], 1
+	case code.OpHash:
+		return 2 * ins.operands[0], 1
+	case code.OpSlice:
+		bounds := ins.operands[0] & (code.SliceStart | code.SliceEnd | code.SliceStep)
+		return 1 + bits.OnesCount(uint(bounds)), 1
+	case code.OpCall:
+		// the callee below its arguments, replaced by the result
+		return ins.operands[0] + 1, 1
+	default:
+		// the infix operators and OpIndex
+		return 2, 1
+	}
+}
+
+// sortedOffsets returns the offsets of decoded in order, so the first
+// problem found is the same from one run to the next
+func sortedOffsets(decoded map[int]instruction) []int {
+	offsets := make([]int, 0, len(decoded))
+	for ip := range decoded {
+		offsets = append(offsets, ip)
+	}
+	sort.Ints(offsets)
+	return offsets
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+// Arity is the range of the number of arguments a builtin accepts. Max is -1
+// for builtins taking any number of arguments from Min on.
+type Arity struct {
+	Min int
+	Max int
+}
+
+// Accepts reports whether a call with n arguments passes the check of the
+// builtin
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Min && (a.Max < 0 || n <= a.Max)
+}
+
+// arities mirrors the checks the standard builtins make on their arguments
+var arities = map[string]Arity{
+	"len":     {1, 1},
+	"type":    {1, 1},
+	"first":   {1, 1},
+	"last":    {1, 1},
+	"tail":    {1, 1},
+	"push":    {2, 2},
+	"puts":    {0, -1},
+	"print":   {0, -1},
+	"eprint":  {0, -1},
+	"printf":  {1, -1},
+	"sprintf": {1, -1},
+	"format":  {1, -1},
+	"input":   {0, 1},
+	"string":  {1, 1},
+	"int":     {1, 1},
+	"bool":    {1, 1},
+
+	"map":      {2, 2},
+	"filter":   {2, 2},
+	"reduce":   {3, 3},
+	"each":     {2, 2},
+	"find":     {2, 2},
+	"any":      {2, 2},
+	"all":      {2, 2},
+	"zip":      {2, -1},
+	"flatten":  {1, 2},
+	"reverse":  {1, 1},
+	"sort":     {1, 1},
+	"sort_by":  {2, 2},
+	"unique":   {1, 1},
+	"group_by": {2, 2},
+
+	"split":       {1, 2},
+	"join":        {1, 2},
+	"trim":        {1, 2},
+	"trim_left":   {1, 2},
+	"trim_right":  {1, 2},
+	"upper":       {1, 1},
+	"lower":       {1, 1},
+	"contains":    {2, 2},
+	"starts_with": {2, 2},
+	"ends_with":   {2, 2},
+	"index_of":    {2, 2},
+	"replace":     {3, 3},
+	"replace_all": {3, 3},
+	"repeat":      {2, 2},
+	"pad_left":    {2, 3},
+	"pad_right":   {2, 3},
+	"chars":       {1, 1},
+	"lines":       {1, 1},
+	"substring":   {2, 3},
+
+	"keys":       {1, 1},
+	"values":     {1, 1},
+	"entries":    {1, 1},
+	"has":        {2, 2},
+	"get":        {2, 3},
+	"delete":     {2, 2},
+	"merge":      {1, -1},
+	"map_values": {2, 2},
+
+	"set": {0, 1},
+}
+
+// IsBuiltin reports whether name is one of the standard builtins
+func IsBuiltin(name string) bool {
+	for _, set := range builtinSets {
+		if _, ok := set[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BuiltinArity returns the arity of the standard builtin name, for tools
+// checking calls before they run
+func BuiltinArity(name string) (Arity, bool) {
+	arity, ok := arities[name]
+	return arity, ok
+}
@@ -0,0 +1,12 @@
+package evaluator_test
+
+import (
+	"monkey/evaluator"
+	"monkey/vm"
+)
+
+// The virtual machine depends on the evaluator, so it is registered from the
+// external test package to avoid an import cycle
+func init() {
+	evaluator.AddBackend("vm", vm.Eval)
+}
@@ -2,29 +2,96 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"monkey/object"
 	"strings"
+	"unicode/utf8"
 )
 
+// builtinSets lists every group of standard builtins
+var builtinSets = []map[string]*object.Builtin{
+	builtins,
+	collectionBuiltins,
+	stringBuiltins,
+	hashBuiltins,
+	setBuiltins,
+}
+
+// defaultRegistry serves environments that have no registry attached
+var defaultRegistry *object.Registry
+
+func init() {
+	defaultRegistry = NewRegistry()
+}
+
+// NewRegistry returns a registry holding the standard builtins. Every call
+// returns an independent registry that hosts can extend or trim without
+// affecting other interpreters.
+func NewRegistry() *object.Registry {
+	registry := object.NewRegistry()
+	for _, set := range builtinSets {
+		for name, builtin := range set {
+			registry.Register(name, builtin.Fn)
+		}
+	}
+	return registry
+}
+
+func lookupBuiltin(env *object.Environment, name string) (object.Object, bool) {
+	registry := env.Registry()
+	if registry == nil {
+		registry = defaultRegistry
+	}
+	return registry.Lookup(name)
+}
+
+// Defined returns a function reporting whether a name is bound in env or is
+// a builtin visible to it, as the resolver needs
+func Defined(env *object.Environment) func(name string) bool {
+	return func(name string) bool {
+		if _, ok := env.Get(name); ok {
+			return true
+		}
+		_, ok := lookupBuiltin(env, name)
+		return ok
+	}
+}
+
 var builtins = map[string]*object.Builtin{
 	"len": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
+				return &object.Integer{Value: int64(arg.Len())}
+			case *object.Hash:
+				return &object.Integer{Value: int64(arg.Len())}
+			case *object.Set:
+				return &object.Integer{Value: int64(arg.Len())}
 			default:
 				return newError("argument to `len` not supported, got %s", arg.Type())
 			}
 		},
 	},
+	"type": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+
+			if instance, ok := args[0].(*object.Instance); ok {
+				return &object.String{Value: instance.Struct.Name}
+			}
+			return &object.String{Value: string(args[0].Type())}
+		},
+	},
 	"first": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
@@ -34,98 +101,152 @@ var builtins = map[string]*object.Builtin{
 				if len(arg.Value) == 0 {
 					return &object.String{Value: ""}
 				}
-				return &object.String{Value: string(arg.Value[0])}
+				r, _ := utf8.DecodeRuneInString(arg.Value)
+				return &object.String{Value: string(r)}
 			case *object.Array:
-				if len(arg.Elements) == 0 {
+				if arg.Len() == 0 {
 					return NULL
 				}
-				return arg.Elements[0]
+				return arg.At(0)
 			default:
 				return newError("argument to `first` not supported, got %s", arg.Type())
 			}
 		},
 	},
 	"last": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				length := len(arg.Value)
-				if length == 0 {
+				if len(arg.Value) == 0 {
 					return &object.String{Value: ""}
 				}
-				return &object.String{Value: string(arg.Value[length-1])}
+				r, _ := utf8.DecodeLastRuneInString(arg.Value)
+				return &object.String{Value: string(r)}
 			case *object.Array:
-				length := len(arg.Elements)
+				length := arg.Len()
 				if length == 0 {
 					return NULL
 				}
-				return arg.Elements[length-1]
+				return arg.At(length - 1)
 			default:
 				return newError("argument to `last` not supported, got %s", arg.Type())
 			}
 		},
 	},
 	"tail": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
 
 			switch arg := args[0].(type) {
 			case *object.String:
-				length := len(arg.Value)
-				if length == 0 {
+				if len(arg.Value) == 0 {
 					return &object.String{Value: ""}
 				}
 
-				return &object.String{Value: strings.Clone(arg.Value[1:length])}
+				_, size := utf8.DecodeRuneInString(arg.Value)
+				return &object.String{Value: strings.Clone(arg.Value[size:])}
 			case *object.Array:
-				length := len(arg.Elements)
+				length := arg.Len()
 				if length == 0 {
 					return NULL
 				}
-				newElements := make([]object.Object, length-1)
-				copy(newElements, arg.Elements[1:length])
-				return &object.Array{Elements: newElements}
+				return arg.Slice(1, length)
 			default:
 				return newError("argument to `tail` not supported, got %s", arg.Type())
 			}
 		},
 	},
 	"push": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
 
 			switch arg := args[0].(type) {
 			case *object.Array:
-				length := len(arg.Elements)
-				newElements := make([]object.Object, length+1)
-				copy(newElements, arg.Elements)
-				newElements[length] = args[1]
-				return &object.Array{Elements: newElements}
+				return arg.Push(args[1])
 			default:
 				return newError("argument to `push` not supported, got %s", arg.Type())
 			}
 		},
 	},
 	"puts": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			out := env.Stdio().Out
 			for _, arg := range args {
-				fmt.Printf("%s\n", arg.Inspect())
+				fmt.Fprintf(out, "%s\n", arg.Inspect())
 			}
 			return NULL
 		},
 	},
+	"print": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			out := env.Stdio().Out
+			for _, arg := range args {
+				fmt.Fprint(out, arg.Inspect())
+			}
+			return NULL
+		},
+	},
+	"eprint": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			out := env.Stdio().Err
+			for _, arg := range args {
+				fmt.Fprint(out, arg.Inspect())
+			}
+			return NULL
+		},
+	},
+	"printf": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			formatted := builtinSprintf(args)
+			if isError(formatted) {
+				return formatted
+			}
+			fmt.Fprint(env.Stdio().Out, formatted.Inspect())
+			return NULL
+		},
+	},
+	"sprintf": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return builtinSprintf(args)
+		},
+	},
+	"format": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return builtinFormat(args)
+		},
+	},
+	"input": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 0, 1)
+			}
+
+			stdio := env.Stdio()
+			if len(args) == 1 {
+				fmt.Fprint(stdio.Out, args[0].Inspect())
+			}
+
+			line, err := stdio.In.ReadString('\n')
+			if err != nil && (err != io.EOF || len(line) == 0) {
+				return NULL
+			}
+			line = strings.TrimSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\r")
+			return &object.String{Value: line}
+		},
+	},
 
 	// Type conversion:
 	"string": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
@@ -133,7 +254,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"int": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
@@ -141,7 +262,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"bool": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
 			}
@@ -149,3 +270,50 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 }
+
+// builtinSprintf formats its arguments with the verbs of Go's fmt package,
+// the first argument being the format string
+func builtinSprintf(args []object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments, got=%d, want at least %d", len(args), 1)
+	}
+
+	format, ok := args[0].(*object.String)
+	if !ok {
+		return newError("format must be %s, got %s", object.StringType, args[0].Type())
+	}
+
+	values := []any{}
+	for _, arg := range args[1:] {
+		switch arg := arg.(type) {
+		case *object.Integer:
+			values = append(values, arg.Value)
+		case *object.Boolean:
+			values = append(values, arg.Value)
+		case *object.String:
+			values = append(values, arg.Value)
+		default:
+			values = append(values, arg.Inspect())
+		}
+	}
+	return &object.String{Value: fmt.Sprintf(format.Value, values...)}
+}
+
+// builtinFormat renders its arguments with formatObjects, the first argument
+// being the format string
+func builtinFormat(args []object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments, got=%d, want at least %d", len(args), 1)
+	}
+
+	format, ok := args[0].(*object.String)
+	if !ok {
+		return newError("format must be %s, got %s", object.StringType, args[0].Type())
+	}
+
+	formatted, err := formatObjects(format.Value, args[1:])
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: formatted}
+}
@@ -35,7 +35,7 @@ func castObjectToInteger(obj object.Object) object.Object {
 func castObjectToBoolean(obj object.Object) *object.Boolean {
 	switch obj := obj.(type) {
 	case *object.Boolean:
-		return obj
+		return nativeBoolToBooleanObject(obj.Value)
 	case *object.Integer:
 		return castIntegerToBoolean(obj)
 	case *object.Null:
@@ -0,0 +1,448 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+)
+
+// collectionBuiltins take callbacks, which may be either user functions or
+// builtins, and call them through applyFunction. Hashes are visited calling
+// the callback with the key and the value of each pair.
+var collectionBuiltins = map[string]*object.Builtin{
+	"map": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			result := []object.Object{}
+			err := iterate(env, "map", args[0], args[1], func(value object.Object, _ []object.Object) bool {
+				result = append(result, value)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			return object.NewArray(result)
+		},
+	},
+	"filter": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			if hash, ok := args[0].(*object.Hash); ok {
+				result := object.NewHash()
+				err := iterate(env, "filter", hash, args[1], func(value object.Object, callArgs []object.Object) bool {
+					if castObjectToBoolean(value) == TRUE {
+						result.Set(callArgs[0].(object.Hashable), callArgs[1])
+					}
+					return true
+				})
+				if err != nil {
+					return err
+				}
+				return result
+			}
+			if set, ok := args[0].(*object.Set); ok {
+				result := object.NewSet()
+				err := iterate(env, "filter", set, args[1], func(value object.Object, callArgs []object.Object) bool {
+					if castObjectToBoolean(value) == TRUE {
+						result.Add(callArgs[0].(object.Hashable))
+					}
+					return true
+				})
+				if err != nil {
+					return err
+				}
+				return result
+			}
+
+			result := []object.Object{}
+			err := iterate(env, "filter", args[0], args[1], func(value object.Object, callArgs []object.Object) bool {
+				if castObjectToBoolean(value) == TRUE {
+					result = append(result, callArgs[0])
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			return object.NewArray(result)
+		},
+	},
+	"reduce": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 3)
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `reduce` not supported, got %s", args[0].Type())
+			}
+
+			accumulated := args[1]
+			for _, el := range arr.Elements() {
+				accumulated = applyFunction(env, args[2], []object.Object{accumulated, el})
+				if isError(accumulated) {
+					return accumulated
+				}
+			}
+			return accumulated
+		},
+	},
+	"each": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			err := iterate(env, "each", args[0], args[1], func(object.Object, []object.Object) bool {
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			return NULL
+		},
+	},
+	"find": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			var found object.Object = NULL
+			err := iterate(env, "find", args[0], args[1], func(value object.Object, callArgs []object.Object) bool {
+				if castObjectToBoolean(value) == TRUE {
+					found = callArgs[len(callArgs)-1]
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			return found
+		},
+	},
+	"any": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			result := FALSE
+			err := iterate(env, "any", args[0], args[1], func(value object.Object, _ []object.Object) bool {
+				if castObjectToBoolean(value) == TRUE {
+					result = TRUE
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			return result
+		},
+	},
+	"all": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			result := TRUE
+			err := iterate(env, "all", args[0], args[1], func(value object.Object, _ []object.Object) bool {
+				if castObjectToBoolean(value) == FALSE {
+					result = FALSE
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			return result
+		},
+	},
+	"zip": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) < 2 {
+				return newError("wrong number of arguments, got=%d, want at least %d", len(args), 2)
+			}
+
+			arrays := []*object.Array{}
+			length := -1
+			for _, arg := range args {
+				arr, ok := arg.(*object.Array)
+				if !ok {
+					return newError("argument to `zip` not supported, got %s", arg.Type())
+				}
+				if length == -1 || arr.Len() < length {
+					length = arr.Len()
+				}
+				arrays = append(arrays, arr)
+			}
+
+			result := make([]object.Object, length)
+			for i := range result {
+				tuple := make([]object.Object, len(arrays))
+				for j, arr := range arrays {
+					tuple[j] = arr.At(i)
+				}
+				result[i] = object.NewArray(tuple)
+			}
+			return object.NewArray(result)
+		},
+	},
+	"flatten": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 1, 2)
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `flatten` not supported, got %s", args[0].Type())
+			}
+
+			depth := int64(1)
+			if len(args) == 2 {
+				integer, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("depth of `flatten` must be %s, got %s", object.IntegerType, args[1].Type())
+				}
+				depth = integer.Value
+			}
+			return object.NewArray(flatten(arr.Elements(), depth))
+		},
+	},
+	"reverse": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				length := arg.Len()
+				result := make([]object.Object, length)
+				for i, el := range arg.Elements() {
+					result[length-1-i] = el
+				}
+				return object.NewArray(result)
+			case *object.String:
+				runes := []rune(arg.Value)
+				for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+					runes[i], runes[j] = runes[j], runes[i]
+				}
+				return &object.String{Value: string(runes)}
+			default:
+				return newError("argument to `reverse` not supported, got %s", arg.Type())
+			}
+		},
+	},
+	"sort": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `sort` not supported, got %s", args[0].Type())
+			}
+			return sortElements(arr.Elements(), arr.Elements())
+		},
+	},
+	"sort_by": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			if _, ok := args[0].(*object.Array); !ok {
+				return newError("argument to `sort_by` not supported, got %s", args[0].Type())
+			}
+
+			keys := []object.Object{}
+			err := iterate(env, "sort_by", args[0], args[1], func(value object.Object, _ []object.Object) bool {
+				keys = append(keys, value)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			return sortElements(args[0].(*object.Array).Elements(), keys)
+		},
+	},
+	"unique": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `unique` not supported, got %s", args[0].Type())
+			}
+
+			seen := object.NewHash()
+			unhashable := []object.Object{}
+			result := []object.Object{}
+			for _, el := range arr.Elements() {
+				hashable, ok := el.(object.Hashable)
+				if ok {
+					if _, found := seen.Get(hashable); !found {
+						seen.Set(hashable, TRUE)
+						result = append(result, el)
+					}
+					continue
+				}
+
+				if !containsEqual(unhashable, el) {
+					unhashable = append(unhashable, el)
+					result = append(result, el)
+				}
+			}
+			return object.NewArray(result)
+		},
+	},
+	"group_by": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+
+			if _, ok := args[0].(*object.Array); !ok {
+				return newError("argument to `group_by` not supported, got %s", args[0].Type())
+			}
+
+			groups := object.NewHash()
+			var keyErr object.Object
+			err := iterate(env, "group_by", args[0], args[1], func(value object.Object, callArgs []object.Object) bool {
+				hashable, ok := value.(object.Hashable)
+				if !ok {
+					keyErr = newError("unusable as hash key: %s", value.Type())
+					return false
+				}
+
+				group, ok := groups.Get(hashable)
+				if !ok {
+					group = &object.Array{}
+				}
+				groups.Set(hashable, group.(*object.Array).Push(callArgs[0]))
+				return true
+			})
+			if err != nil {
+				return err
+			}
+			if keyErr != nil {
+				return keyErr
+			}
+			return groups
+		},
+	},
+}
+
+// iterate calls fn with every element of an array or set, or with the key and
+// the value of every pair when collection is a hash, and hands each result to
+// visit together with the arguments that produced it. Iteration stops when
+// visit returns false. Errors returned by fn are propagated.
+func iterate(
+	env *object.Environment,
+	name string,
+	collection object.Object,
+	fn object.Object,
+	visit func(value object.Object, callArgs []object.Object) bool,
+) object.Object {
+	switch collection := collection.(type) {
+	case *object.Array:
+		for _, el := range collection.Elements() {
+			args := []object.Object{el}
+			value := applyFunction(env, fn, args)
+			if isError(value) {
+				return value
+			}
+			if !visit(value, args) {
+				break
+			}
+		}
+	case *object.Set:
+		for _, el := range collection.Elements() {
+			args := []object.Object{el}
+			value := applyFunction(env, fn, args)
+			if isError(value) {
+				return value
+			}
+			if !visit(value, args) {
+				break
+			}
+		}
+	case *object.Hash:
+		for _, pair := range collection.Pairs() {
+			args := []object.Object{pair.Key, pair.Value}
+			value := applyFunction(env, fn, args)
+			if isError(value) {
+				return value
+			}
+			if !visit(value, args) {
+				break
+			}
+		}
+	default:
+		return newError("argument to `%s` not supported, got %s", name, collection.Type())
+	}
+	return nil
+}
+
+func flatten(elements []object.Object, depth int64) []object.Object {
+	result := []object.Object{}
+	for _, el := range elements {
+		if arr, ok := el.(*object.Array); ok && depth > 0 {
+			result = append(result, flatten(arr.Elements(), depth-1)...)
+		} else {
+			result = append(result, el)
+		}
+	}
+	return result
+}
+
+// sortElements returns a new array with elements stably sorted by the
+// matching entry of keys, or the first error comparing two keys
+func sortElements(elements []object.Object, keys []object.Object) object.Object {
+	indexes := make([]int, len(elements))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	var err error
+	sort.SliceStable(indexes, func(i, j int) bool {
+		result, compareErr := object.Compare(keys[indexes[i]], keys[indexes[j]])
+		if compareErr != nil && err == nil {
+			err = compareErr
+		}
+		return result < 0
+	})
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	result := make([]object.Object, len(elements))
+	for i, index := range indexes {
+		result[i] = elements[index]
+	}
+	return object.NewArray(result)
+}
+
+func containsEqual(elements []object.Object, target object.Object) bool {
+	for _, el := range elements {
+		if object.Equal(el, target) {
+			return true
+		}
+	}
+	return false
+}
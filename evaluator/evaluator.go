@@ -32,16 +32,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		setVariable(node.Name, val, env)
 	case *ast.AssignmentStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		assigned := env.Assign(node.Name.Value, val)
+		assigned := assignVariable(node.Name, val, env)
 		if isError(assigned) {
 			return assigned
 		}
+	case *ast.StructStatement:
+		setVariable(node.Name, evalStructStatement(node, env), env)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -61,9 +67,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return object.NewArray(elements)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.SetLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return newSet(elements)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.IfExpression:
@@ -71,7 +83,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body, Locals: node.Locals}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
@@ -82,7 +94,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return applyFunction(env, function, args)
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
@@ -109,13 +121,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return evalIndexExpression(left, index, env)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
 	case *ast.DotExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		return evalDotExpression(left, node.Right)
+		return evalDotExpression(left, node.Right.Value, env)
 	}
 	return NULL
 }
@@ -176,30 +190,69 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return result
 }
 
-func applyFunction(fn object.Object, arguments []object.Object) object.Object {
+func applyFunction(env *object.Environment, fn object.Object, arguments []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		if len(arguments) < len(fn.Parameters) {
-			missing := []string{}
-			for _, param := range fn.Parameters[len(arguments):] {
-				missing = append(missing, param.Value)
-			}
-			return newError("function call is missing parameters: %s", strings.Join(missing, ", "))
+		return callFunction(env, fn, arguments, nil)
+	case *object.BoundMethod:
+		if method, ok := fn.Method.(*object.Function); ok {
+			return callFunction(env, method, arguments, fn.Receiver)
 		}
-		extendedEnv := extendFunctionEnv(fn, arguments)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		return applyFunction(env, fn.Method, append([]object.Object{fn.Receiver}, arguments...))
 	case *object.Builtin:
-		return fn.Fn(arguments...)
+		return fn.Fn(env, arguments...)
+	case *object.Struct:
+		return newInstance(fn, arguments)
+	case object.Callable:
+		return fn.Call(env, arguments)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// MaxCallDepth is the number of calls that can be in progress at once, in
+// both backends, before a call fails with a stack overflow
+const MaxCallDepth = 1 << 16
+
+// callFunction evaluates the body of fn with its parameters bound to
+// arguments and, when calling a method, self bound to the receiver. Calls
+// nesting deeper than MaxCallDepth in env are a stack overflow.
+func callFunction(env *object.Environment, fn *object.Function, arguments []object.Object, self object.Object) object.Object {
+	if len(arguments) < len(fn.Parameters) {
+		missing := []string{}
+		for _, param := range fn.Parameters[len(arguments):] {
+			missing = append(missing, param.Value)
+		}
+		return newError("function call is missing parameters: %s", strings.Join(missing, ", "))
+	}
+	if env.Depth() >= MaxCallDepth {
+		return newError("stack overflow")
+	}
+	extendedEnv := extendFunctionEnv(fn, arguments)
+	extendedEnv.SetDepth(env.Depth() + 1)
+	if self != nil {
+		if fn.Locals != nil {
+			extendedEnv.SetAt(0, self)
+		} else {
+			extendedEnv.Set("self", self)
+		}
+	}
+	evaluated := Eval(fn.Body, extendedEnv)
+	return unwrapReturnValue(evaluated)
+}
+
 func extendFunctionEnv(fn *object.Function, arguments []object.Object) *object.Environment {
-	env := object.NewEnclousedEnvironment(fn.Env)
+	if fn.Locals == nil {
+		env := object.NewEnclousedEnvironment(fn.Env)
+		for i, param := range fn.Parameters {
+			env.Set(param.Value, arguments[i])
+		}
+		return env
+	}
+
+	env := object.NewFunctionEnvironment(fn.Env, len(fn.Locals))
 	for i, param := range fn.Parameters {
-		env.Set(param.Value, arguments[i])
+		env.SetAt(param.Binding.Slot, arguments[i])
 	}
 	return env
 }
@@ -213,10 +266,10 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
@@ -225,29 +278,52 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		if !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
-		value := Eval(valueNode, env)
+		value := Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashable.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashable, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if node.Binding != nil {
+		if val, ok := env.GetAt(node.Binding.Depth, node.Binding.Slot); ok {
+			return val
+		}
+		return newError("identifier %s is undefined", node.Value)
+	}
+
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := lookupBuiltin(env, node.Value); ok {
 		return builtin
 	}
 	return newError("identifier %s is undefined", node.Value)
 }
 
+// setVariable declares the variable named by ident, in the slot given by the
+// resolver for locals and by name otherwise
+func setVariable(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	if ident.Binding != nil {
+		env.SetAt(ident.Binding.Slot, val)
+	} else {
+		env.Set(ident.Value, val)
+	}
+}
+
+func assignVariable(ident *ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	if ident.Binding != nil {
+		return env.AssignAt(ident.Binding.Depth, ident.Binding.Slot, ident.Value, val)
+	}
+	return env.Assign(ident.Value, val)
+}
+
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
@@ -261,14 +337,32 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
+	case operator == "in":
+		return evalMembershipExpression(left, right)
+	case operator == "not in":
+		result := evalMembershipExpression(left, right)
+		if isError(result) {
+			return result
+		}
+		return nativeBoolToBooleanObject(result != TRUE)
+	case operator == "*" && isRepeatable(left) && right.Type() == object.IntegerType:
+		return evalRepetitionExpression(left, right.(*object.Integer).Value)
+	case operator == "*" && left.Type() == object.IntegerType && isRepeatable(right):
+		return evalRepetitionExpression(right, left.(*object.Integer).Value)
 	case left.Type() == object.IntegerType && right.Type() == object.IntegerType:
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.StringType && right.Type() == object.StringType:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	case left.Type() == object.ArrayType && right.Type() == object.ArrayType:
+		return evalArrayInfixExpression(operator, left, right)
+	case left.Type() == object.HashType && right.Type() == object.HashType:
+		return evalHashInfixExpression(operator, left, right)
+	case left.Type() == object.SetType && right.Type() == object.SetType:
+		return evalSetInfixExpression(operator, left, right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
@@ -287,6 +381,9 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %d / 0", leftVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -307,21 +404,139 @@ func evalStringInfixExpression(operator string, left object.Object, right object
 	switch operator {
 	case "+":
 		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
 	case "==":
-		return &object.Boolean{Value: leftVal == rightVal}
+		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
-		return &object.Boolean{Value: leftVal != rightVal}
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalArrayInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	switch operator {
+	case "+":
+		leftElements := left.(*object.Array).Elements()
+		rightElements := right.(*object.Array).Elements()
+		elements := make([]object.Object, 0, len(leftElements)+len(rightElements))
+		elements = append(elements, leftElements...)
+		elements = append(elements, rightElements...)
+		return object.NewArray(elements)
+	case "<", ">":
+		result, err := object.Compare(left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if operator == "<" {
+			return nativeBoolToBooleanObject(result < 0)
+		}
+		return nativeBoolToBooleanObject(result > 0)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalIndexExpression(left object.Object, index object.Object) object.Object {
+// evalHashInfixExpression only supports +, which merges both hashes into a
+// new one where the pairs of right win over those of left
+func evalHashInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	if operator != "+" {
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	result := left.(*object.Hash).Copy()
+	for _, pair := range right.(*object.Hash).Pairs() {
+		result.Set(pair.Key.(object.Hashable), pair.Value)
+	}
+	return result
+}
+
+func isRepeatable(obj object.Object) bool {
+	return obj.Type() == object.StringType || obj.Type() == object.ArrayType
+}
+
+// maxArrayLength bounds the arrays built by repetition, as maxStringLength
+// does for strings
+const maxArrayLength = 1 << 24
+
+// evalRepetitionExpression concatenates count copies of a string or array,
+// array elements are shared rather than copied
+func evalRepetitionExpression(obj object.Object, count int64) object.Object {
+	if count < 0 {
+		return newError("negative repetition count: %d", count)
+	}
+
+	length, limit := 0, maxArrayLength
+	switch obj := obj.(type) {
+	case *object.String:
+		length, limit = len(obj.Value), maxStringLength
+	case *object.Array:
+		length = obj.Len()
+	}
+	if length == 0 {
+		count = 0
+	} else if count > int64(limit/length) {
+		return newError("repetition count too large: %d", count)
+	}
+
+	switch obj := obj.(type) {
+	case *object.String:
+		return &object.String{Value: strings.Repeat(obj.Value, int(count))}
+	default:
+		elements := obj.(*object.Array).Elements()
+		repeated := make([]object.Object, 0, len(elements)*int(count))
+		for i := int64(0); i < count; i++ {
+			repeated = append(repeated, elements...)
+		}
+		return object.NewArray(repeated)
+	}
+}
+
+// evalMembershipExpression looks for left among the elements of an array,
+// the substrings of a string, the keys of a hash or the elements of a set
+func evalMembershipExpression(left object.Object, right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Array:
+		for _, el := range right.Elements() {
+			if object.Equal(left, el) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *object.String:
+		str, ok := left.(*object.String)
+		if !ok {
+			return newError("type mismatch: %s in %s", left.Type(), right.Type())
+		}
+		return nativeBoolToBooleanObject(strings.Contains(right.Value, str.Value))
+	case *object.Hash:
+		key, ok := left.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", left.Type())
+		}
+		_, ok = right.Get(key)
+		return nativeBoolToBooleanObject(ok)
+	case *object.Set:
+		el, ok := left.(object.Hashable)
+		if !ok {
+			return newError("unusable as set element: %s", left.Type())
+		}
+		return nativeBoolToBooleanObject(right.Has(el))
+	default:
+		return newError("unknown operator: %s in %s", left.Type(), right.Type())
+	}
+}
+
+func evalIndexExpression(left object.Object, index object.Object, env *object.Environment) object.Object {
+	strict := env.Options().StrictIndexing
 	switch {
 	case left.Type() == object.ArrayType && index.Type() == object.IntegerType:
-		return evalArrayIndexExpression(left, index)
+		return evalArrayIndexExpression(left, index, strict)
 	case left.Type() == object.StringType && index.Type() == object.IntegerType:
-		return evalStringIndexExpression(left, index)
+		return evalStringIndexExpression(left, index, strict)
 	case left.Type() == object.HashType:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -329,35 +544,167 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 	}
 }
 
-func evalDotExpression(left object.Object, right *ast.Identifier) object.Object {
+func evalDotExpression(left object.Object, name string, env *object.Environment) object.Object {
 	switch {
 	case left.Type() == object.HashType:
-		return evalHashDotExpression(left, right)
+		return evalHashDotExpression(left, name, env)
+	case left.Type() == object.ModuleType:
+		return evalModuleDotExpression(left, name)
+	case left.Type() == object.InstanceType:
+		return evalInstanceDotExpression(left, name)
 	default:
-		return newError("dot operator not supported: %s", left.Type())
+		if method, ok := lookupMethod(env, left, name); ok {
+			return method
+		}
+		return newError("no method %s on %s", name, left.Type())
+	}
+}
+
+// normalizeIndex resolves negative indexes counting from the end, reporting
+// false when idx falls outside a sequence of the given length
+func normalizeIndex(idx int64, length int) (int64, bool) {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	return idx, idx >= 0 && idx < int64(length)
+}
+
+func indexOutOfRange(obj object.Object, idx int64, length int, strict bool) object.Object {
+	if !strict {
+		return NULL
 	}
+	return newError("index error: %d out of range for %s of length %d", idx, obj.Type(), length)
 }
 
-func evalArrayIndexExpression(array object.Object, index object.Object) object.Object {
+func evalArrayIndexExpression(array object.Object, index object.Object, strict bool) object.Object {
 	arrayObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObj.Elements) - 1)
 
-	if idx < 0 || idx > max {
-		return NULL
+	normalized, ok := normalizeIndex(idx, arrayObj.Len())
+	if !ok {
+		return indexOutOfRange(array, idx, arrayObj.Len(), strict)
 	}
-	return arrayObj.Elements[idx]
+	return arrayObj.At(int(normalized))
 }
 
-func evalStringIndexExpression(str object.Object, index object.Object) object.Object {
-	strObj := str.(*object.String)
+func evalStringIndexExpression(str object.Object, index object.Object, strict bool) object.Object {
+	runes := []rune(str.(*object.String).Value)
 	idx := index.(*object.Integer).Value
-	max := int64(len(strObj.Value) - 1)
 
-	if idx < 0 || idx > max {
-		return NULL
+	normalized, ok := normalizeIndex(idx, len(runes))
+	if !ok {
+		return indexOutOfRange(str, idx, len(runes), strict)
+	}
+	return &object.String{Value: string(runes[normalized])}
+}
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	bounds := []object.Object{nil, nil, nil}
+	for i, boundNode := range []ast.Expression{node.Start, node.End, node.Step} {
+		if boundNode == nil {
+			continue
+		}
+		bound := Eval(boundNode, env)
+		if isError(bound) {
+			return bound
+		}
+		bounds[i] = bound
 	}
-	return &object.String{Value: string(strObj.Value[idx])}
+	return evalSlice(left, bounds[0], bounds[1], bounds[2])
+}
+
+// evalSlice slices left between the given bounds, nil standing for an
+// omitted bound
+func evalSlice(left object.Object, start, end, step object.Object) object.Object {
+	bounds := []*int64{nil, nil, nil}
+	for i, bound := range []object.Object{start, end, step} {
+		if bound == nil {
+			continue
+		}
+		integer, ok := bound.(*object.Integer)
+		if !ok {
+			return newError("slice indexes must be %s, got %s", object.IntegerType, bound.Type())
+		}
+		bounds[i] = &integer.Value
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		indexes, err := sliceIndexes(left.Len(), bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return err
+		}
+		if (bounds[2] == nil || *bounds[2] == 1) && len(indexes) > 0 {
+			// contiguous slices share the elements of left
+			return left.Slice(indexes[0], indexes[0]+len(indexes))
+		}
+		elements := make([]object.Object, len(indexes))
+		for i, idx := range indexes {
+			elements[i] = left.At(idx)
+		}
+		return object.NewArray(elements)
+	case *object.String:
+		runes := []rune(left.Value)
+		indexes, err := sliceIndexes(len(runes), bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return err
+		}
+		var out strings.Builder
+		for _, idx := range indexes {
+			out.WriteRune(runes[idx])
+		}
+		return &object.String{Value: out.String()}
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+// sliceIndexes lists the positions selected by [start:end:step] on a sequence
+// of the given length. Like Python, omitted bounds default to the whole
+// sequence in the direction of step, negative bounds count from the end and
+// out of range bounds are clamped.
+func sliceIndexes(length int, start *int64, end *int64, step *int64) ([]int, *object.Error) {
+	n := int64(length)
+	stride := int64(1)
+	if step != nil {
+		stride = *step
+	}
+	if stride == 0 {
+		return nil, newError("slice step cannot be zero")
+	}
+
+	// lower and upper are the clamping limits, -1 meaning before the first
+	// element when walking backwards
+	lower, upper := int64(0), n
+	from, to := int64(0), n
+	if stride < 0 {
+		lower, upper = -1, n-1
+		from, to = n-1, -1
+	}
+
+	clamp := func(bound int64) int64 {
+		if bound < 0 {
+			bound += n
+		}
+		return max(lower, min(bound, upper))
+	}
+	if start != nil {
+		from = clamp(*start)
+	}
+	if end != nil {
+		to = clamp(*end)
+	}
+
+	indexes := []int{}
+	for i := from; (stride > 0 && i < to) || (stride < 0 && i > to); i += stride {
+		indexes = append(indexes, int(i))
+	}
+	return indexes, nil
 }
 
 func evalHashIndexExpression(obj object.Object, index object.Object) object.Object {
@@ -368,23 +715,81 @@ func evalHashIndexExpression(obj object.Object, index object.Object) object.Obje
 		return newError("unable to use hash key: %s", index.Type())
 	}
 
-	pair, ok := hash.Pairs[key.HashKey()]
+	value, ok := hash.Get(key)
 	if !ok {
 		return NULL
 	}
-	return pair.Value
+	return value
 }
 
-func evalHashDotExpression(left object.Object, right *ast.Identifier) object.Object {
+// evalHashDotExpression reads the value stored under the name as a string
+// key. Names missing from the hash fall back to the hash methods, and then to
+// null.
+func evalHashDotExpression(left object.Object, name string, env *object.Environment) object.Object {
 	hash := left.(*object.Hash)
 
-	key := &object.String{Value: right.Value}
+	key := &object.String{Value: name}
 
-	pair, ok := hash.Pairs[key.HashKey()]
+	if value, ok := hash.Get(key); ok {
+		return value
+	}
+	if method, ok := lookupMethod(env, hash, name); ok {
+		return method
+	}
+	return NULL
+}
+
+func evalModuleDotExpression(left object.Object, name string) object.Object {
+	module := left.(*object.Module)
+
+	member, ok := module.Members[name]
 	if !ok {
-		return NULL
+		return newError("identifier %s.%s is undefined", module.Name, name)
+	}
+	return member
+}
+
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) *object.Struct {
+	structObj := &object.Struct{
+		Name:    node.Name.Value,
+		Methods: map[string]object.Object{},
+	}
+	for _, field := range node.Fields {
+		structObj.Fields = append(structObj.Fields, field.Value)
+	}
+	for _, method := range node.Methods {
+		structObj.Methods[method.Name.Value] = &object.Function{
+			Parameters: method.Function.Parameters,
+			Body:       method.Function.Body,
+			Env:        env,
+			Locals:     method.Function.Locals,
+		}
+	}
+	return structObj
+}
+
+func newInstance(structObj *object.Struct, arguments []object.Object) object.Object {
+	if len(arguments) != len(structObj.Fields) {
+		return newError("wrong number of arguments for %s, got=%d, want=%d",
+			structObj.Name, len(arguments), len(structObj.Fields))
+	}
+	values := make([]object.Object, len(arguments))
+	copy(values, arguments)
+	return &object.Instance{Struct: structObj, Values: values}
+}
+
+// evalInstanceDotExpression looks up a field of the instance or, failing
+// that, one of the methods of its struct
+func evalInstanceDotExpression(left object.Object, name string) object.Object {
+	instance := left.(*object.Instance)
+
+	if value, ok := instance.Field(name); ok {
+		return value
+	}
+	if method, ok := instance.Struct.Methods[name]; ok {
+		return &object.BoundMethod{Receiver: instance, Method: method, Name: name}
 	}
-	return pair.Value
+	return newError("%s has no field or method %s", instance.Struct.Name, name)
 }
 
 func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
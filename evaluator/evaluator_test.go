@@ -2,9 +2,15 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/resolver"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -59,6 +65,7 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
 		{"(1 < 2) == (2 > 1)", true},
+		{`if ("a" == "a") { true } else { false }`, true},
 	}
 
 	for _, tt := range tests {
@@ -120,26 +127,55 @@ func TestHashLiterals(t *testing.T) {
 		return
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		(&object.Boolean{Value: true}).HashKey():   5,
-		(&object.Boolean{Value: false}).HashKey():  6,
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{&object.Boolean{Value: true}, 5},
+		{&object.Boolean{Value: false}, 6},
+	}
+
+	if result.Len() != len(expected) {
+		t.Fatalf("array has wrong number of pairs, got=%d, want=%d ", result.Len(), len(expected))
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("array has wrong number of pairs, got=%d, want=%d ", len(result.Pairs), len(expected))
+	for i, pair := range result.Pairs() {
+		if pair.Key.Inspect() != expected[i].key.Inspect() {
+			t.Errorf("pair %d has wrong key, got=%s, want=%s", i, pair.Key.Inspect(), expected[i].key.Inspect())
+		}
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, expectedPair := range expected {
+		value, ok := result.Get(expectedPair.key)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 			continue
 		}
-		testIntegerObject(t, pair.Value, expectedValue)
+		testIntegerObject(t, value, expectedPair.value)
+	}
+}
+
+func TestHashOrdering(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 10: 3, true: 4, "c": 5}`, "{b:1, a:2, 10:3, true:4, c:5}"},
+		{`{"b": 1, "a": 2, "b": 3}`, "{b:3, a:2}"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a:1, c:3}"},
+		{`merge({"z": 1, "a": 1}, {"m": 2, "z": 2})`, "{z:2, a:1, m:2}"},
+		{`let log = []; let note = fn(x) { log = push(log, x); x }; {note("c"): note(1), note("a"): note(2)}; log`, "[c, 1, a, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong inspect output for %q, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
 	}
 }
 
@@ -153,6 +189,16 @@ func TestIndexExpressions(t *testing.T) {
 		{"[1, 2, \"foo\"][2]", "foo"},
 		{"let myArray = [1, 2, \"foo\"]; myArray[2];", "foo"},
 		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[3]`, nil},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[-4]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`"日本語"[3]`, nil},
+		{`let s = "héllo"; s[len(s) - 1]`, "o"},
 	}
 
 	for _, tt := range tests {
@@ -168,6 +214,68 @@ func TestIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"[1, 2, 3, 4, 5][1:3]", []any{2, 3}},
+		{"[1, 2, 3, 4, 5][:2]", []any{1, 2}},
+		{"[1, 2, 3, 4, 5][3:]", []any{4, 5}},
+		{"[1, 2, 3, 4, 5][:]", []any{1, 2, 3, 4, 5}},
+		{"[1, 2, 3, 4, 5][::2]", []any{1, 3, 5}},
+		{"[1, 2, 3, 4, 5][-2:]", []any{4, 5}},
+		{"[1, 2, 3, 4, 5][:-3]", []any{1, 2}},
+		{"[1, 2, 3, 4, 5][::-1]", []any{5, 4, 3, 2, 1}},
+		{"[1, 2, 3, 4, 5][3:0:-1]", []any{4, 3, 2}},
+		{"[1, 2, 3, 4, 5][-1:-6:-2]", []any{5, 3, 1}},
+		{"[1, 2, 3][1:100]", []any{2, 3}},
+		{"[1, 2, 3][-100:1]", []any{1}},
+		{"[1, 2, 3][2:1]", []any{}},
+		{"[][::-1]", []any{}},
+		{"let n = 2; [1, 2, 3][n - 1:n + 1]", []any{2, 3}},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[::-1]`, "olleh"},
+		{`"hello"[-3:]`, "llo"},
+		{`"hello"[10:]`, ""},
+		{`"héllo"[1:2]`, "é"},
+		{`"héllo"[:3]`, "hél"},
+		{`"日本語"[::-1]`, "語本日"},
+		{"[1, 2][::0]", "slice step cannot be zero"},
+		{`[1, 2]["a":]`, "slice indexes must be INTEGER, got STRING"},
+		{`{"a": 1}[1:]`, "slice operator not supported: HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestStrictIndexing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"[1, 2, 3][3]", "index error: 3 out of range for ARRAY of length 3"},
+		{"[1, 2, 3][-4]", "index error: -4 out of range for ARRAY of length 3"},
+		{`"abc"[5]`, "index error: 5 out of range for STRING of length 3"},
+		{`"日本語"[3]`, "index error: 3 out of range for STRING of length 3"},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][1:10]", []any{2, 3}},
+		{`{}["missing"]`, nil},
+	}
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		for _, tt := range tests {
+			env := object.NewEnvironment()
+			env.SetOptions(&object.Options{StrictIndexing: true})
+			evaluated := testEvalOn(b, tt.input, env)
+			testExpectedObject(t, evaluated, tt.expected)
+		}
+	})
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -218,6 +326,241 @@ func TestHashDotExpressions(t *testing.T) {
 	}
 }
 
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"abc".len()`, 3},
+		{`"héllo".len()`, 5},
+		{`"éa".first()`, "é"},
+		{`"aé".last()`, "é"},
+		{`"éab".tail()`, "ab"},
+		{`"a,b".split(",")`, []any{"a", "b"}},
+		{`" hi ".trim().upper()`, "HI"},
+		{`"%d-%d".format(1, 2)`, "1-2"},
+		{`[1, 2, 3].map(fn(x) { x * 2 })`, []any{2, 4, 6}},
+		{`[3, 1, 2].sort().reverse().first()`, 3},
+		{`[1, 2, 3].reduce(0, fn(acc, x) { acc + x })`, 6},
+		{`[1, 2].push(3).len()`, 3},
+		{`["a", "b"].join("-")`, "a-b"},
+		{`{"a": 1, "b": 2}.keys()`, []any{"a", "b"}},
+		{`{"a": 1}.get("b", 0)`, 0},
+		{`{"a": 1}.has("a")`, true},
+		{`#{1, 2}.len()`, 2},
+		{`12.string()`, "12"},
+		{`let double = fn(x) { x * 2 }; {"double": double}.double(4)`, 8},
+		{`{"len": fn() { 42 }}.len()`, 42},
+		{`{"keys": 1}.keys`, 1},
+		{`{}.missing`, nil},
+		{`let upper = "abc".upper; upper()`, "ABC"},
+		{`"abc".push(1)`, "no method push on STRING"},
+		{`[1].upper()`, "no method upper on ARRAY"},
+		{`1.len()`, "no method len on INTEGER"},
+		{`true.string()`, "no method string on BOOLEAN"},
+		{`"abc".upper(1)`, "wrong number of arguments, got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		registry := NewRegistry()
+		registry.Unregister("upper")
+		env := object.NewEnvironmentWithRegistry(registry)
+		testErrorObject(t, testEvalOn(b, `"abc".upper()`, env), "no method upper on STRING")
+	})
+
+	method := testEval(`[1].len`)
+	if method.Inspect() != "method ARRAY.len" {
+		t.Errorf("wrong Inspect for method. got=%q", method.Inspect())
+	}
+
+	for objType, methods := range methodTables {
+		for _, name := range methods {
+			if _, ok := defaultRegistry.Lookup(name); !ok {
+				t.Errorf("method %s of %s is not a builtin", name, objType)
+			}
+		}
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, [2, "a"]] == [1, [2, "a"]]`, true},
+		{`[] == []`, true},
+		{`[1] == [1, 2]`, false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} != {"a": 1, "b": 2}`, true},
+		{`[1] == 1`, false},
+		{`[1] != {}`, true},
+		{`let f = fn() {}; f == f`, true},
+		{`fn() {} == fn() {}`, false},
+		{`[1, 2] < [1, 3]`, true},
+		{`[1, 2] < [1, 2, 0]`, true},
+		{`[2] > [1, 9]`, true},
+		{`[1, 2] > [1, 2]`, false},
+		{`"abc" < "abd"`, true},
+		{`"b" > "abc"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("\tinput: %s", tt.input)
+		}
+	}
+
+	testErrorObject(t, testEval(`[1] < ["a"]`), "unable to compare INTEGER and STRING")
+	testErrorObject(t, testEval(`{} < {}`), "unknown operator: HASH < HASH")
+
+	expected := object.NewHash()
+	expected.Set(&object.String{Value: "a"}, object.NewArray([]object.Object{TRUE}))
+	testObjectEqual(t, testEval(`{"a": [1 < 2]}`), expected)
+}
+
+func TestCollectionOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"[1, 2] + [3]", []any{1, 2, 3}},
+		{"[] + []", []any{}},
+		{"let a = [1]; let b = a + [2]; len(a)", 1},
+		{`"ab" * 3`, "ababab"},
+		{`2 * "ab"`, "abab"},
+		{`"ab" * 0`, ""},
+		{"[0] * 3", []any{0, 0, 0}},
+		{"[1, 2] * 2", []any{1, 2, 1, 2}},
+		{"3 * [1]", []any{1, 1, 1}},
+		{"[1] * 0", []any{}},
+		{`"a" * -1`, "negative repetition count: -1"},
+		{"[1] * -2", "negative repetition count: -2"},
+		{"[0] * 9223372036854775807", "repetition count too large: 9223372036854775807"},
+		{`"ab" * 4611686018427387904`, "repetition count too large: 4611686018427387904"},
+		{`100000000 * "a"`, "repetition count too large: 100000000"},
+		{"[] * 9223372036854775807", []any{}},
+		{`[1] * "a"`, "type mismatch: ARRAY * STRING"},
+		{`{"a": 1} - {"b": 2}`, "unknown operator: HASH - HASH"},
+		{`[1] + {}`, "type mismatch: ARRAY + HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+
+	evaluated := testEval(`let a = {"a": 1, "b": 2}; let b = a + {"b": 3, "c": 4}; [a, b]`)
+	original := object.NewHash()
+	original.Set(&object.String{Value: "a"}, &object.Integer{Value: 1})
+	original.Set(&object.String{Value: "b"}, &object.Integer{Value: 2})
+	merged := object.NewHash()
+	merged.Set(&object.String{Value: "a"}, &object.Integer{Value: 1})
+	merged.Set(&object.String{Value: "b"}, &object.Integer{Value: 3})
+	merged.Set(&object.String{Value: "c"}, &object.Integer{Value: 4})
+	testObjectEqual(t, evaluated, object.NewArray([]object.Object{original, merged}))
+}
+
+func TestMembershipOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"2 in [1, 2, 3]", true},
+		{"4 in [1, 2, 3]", false},
+		{"[1] in [[1], [2]]", true},
+		{`"a" in [1, 2]`, false},
+		{"4 not in [1, 2, 3]", true},
+		{"2 not in [1, 2, 3]", false},
+		{`"ell" in "hello"`, true},
+		{`"" in "hello"`, true},
+		{`"x" not in "hello"`, true},
+		{`"a" in {"a": 1}`, true},
+		{`"b" in {"a": 1}`, false},
+		{`1 not in {true: 1}`, true},
+		{"1 + 1 in [2] == true", true},
+		{`1 in "abc"`, "type mismatch: INTEGER in STRING"},
+		{`[1] in {}`, "unusable as hash key: ARRAY"},
+		{"1 in 1", "unknown operator: INTEGER in INTEGER"},
+		{"1 not in 1", "unknown operator: INTEGER in INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(bool); ok {
+			if !testBooleanObject(t, evaluated, expected) {
+				t.Errorf("\tinput: %s", tt.input)
+			}
+			continue
+		}
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"#{1, 2, 2, 3}", "#{1, 2, 3}"},
+		{`#{"b", "a", "b"}`, "#{b, a}"},
+		{"#{}", "#{}"},
+		{"set()", "#{}"},
+		{"set([3, 1, 3])", "#{3, 1}"},
+		{`set("abca")`, "#{a, b, c}"},
+		{`set({"a": 1, "b": 2})`, "#{a, b}"},
+		{"let a = #{1}; let b = set(a); b == a", true},
+		{"#{1, 2} | #{2, 3}", "#{1, 2, 3}"},
+		{"#{1, 2, 3} & #{3, 2, 4}", "#{2, 3}"},
+		{"#{1, 2, 3} - #{2}", "#{1, 3}"},
+		{"#{1, 2} | #{3} & #{3, 4}", "#{1, 2, 3}"},
+		{"#{1, 2} == #{2, 1}", true},
+		{"#{1} != #{1, 2}", true},
+		{"2 in #{1, 2}", true},
+		{"3 not in #{1, 2}", true},
+		{"len(#{1, 2, 1})", 2},
+		{"map(#{1, 2}, fn(x) { x * 10 })", []any{10, 20}},
+		{"filter(#{1, 2, 3}, fn(x) { x > 1 })", "#{2, 3}"},
+		{"reduce(map(#{3, 1}, fn(x) { x }), 0, fn(acc, x) { acc + x })", 4},
+		{"#{[1]}", "unusable as set element: ARRAY"},
+		{"set([{}])", "unusable as set element: HASH"},
+		{"[1] in #{1}", "unusable as set element: ARRAY"},
+		{"set(1)", "argument to `set` not supported, got INTEGER"},
+		{"set([], [])", "wrong number of arguments, got=2, want=0 or 1"},
+		{"#{1} + #{2}", "unknown operator: SET + SET"},
+		{"#{1} | [2]", "type mismatch: SET | ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			if !testBooleanObject(t, evaluated, expected) {
+				t.Errorf("\tinput: %s", tt.input)
+			}
+		case string:
+			if set, ok := evaluated.(*object.Set); ok {
+				if set.Inspect() != expected {
+					t.Errorf("wrong set for %q. got=%s, want=%s", tt.input, set.Inspect(), expected)
+				}
+				continue
+			}
+			testErrorObject(t, evaluated, expected)
+		default:
+			testExpectedObject(t, evaluated, tt.expected)
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -347,6 +690,67 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+func TestStructs(t *testing.T) {
+	declaration := `
+	struct Point {
+		x, y
+		fn sum() { self.x + self.y }
+		fn scale(k) { Point(self.x * k, self.y * k) }
+		fn sumScaled(k) { self.scale(k).sum() }
+	}
+	struct Pair { first, second }
+	`
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"Point(1, 2).x", 1},
+		{"let p = Point(1, 2); p.y", 2},
+		{"Point(1, 2).sum()", 3},
+		{"Point(1, 2).scale(3).y", 6},
+		{"Point(1, 2).sumScaled(2)", 6},
+		{"let sum = Point(3, 4).sum; sum()", 7},
+		{"let self = 10; Point(1, 2).sum() + self", 13},
+		{`type(Point(1, 2))`, "Point"},
+		{`type(Pair(1, 2))`, "Pair"},
+		{`type(1)`, "INTEGER"},
+		{`type(Point)`, "STRUCT"},
+		{"Point(1, 2) == Point(1, 2)", true},
+		{"Point(1, 2) == Point(2, 1)", false},
+		{"Point(1, 2) == Pair(1, 2)", false},
+		{`Pair("a", [1]).second`, []any{1}},
+		{"Point(1)", "wrong number of arguments for Point, got=1, want=2"},
+		{"Point(1, 2, 3)", "wrong number of arguments for Point, got=3, want=2"},
+		{"Point(1, 2).z", "Point has no field or method z"},
+		{"Point(1, 2).scale()", "function call is missing parameters: k"},
+		{"type()", "wrong number of arguments, got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(declaration + tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+
+	inspected := []struct {
+		input    string
+		expected string
+	}{
+		{"Point(1, 2)", "Point{x: 1, y: 2}"},
+		{`Pair("a", Point(1, 2))`, "Pair{first: a, second: Point{x: 1, y: 2}}"},
+		{`format("%v", Pair("a", 1))`, `Pair{first: "a", second: 1}`},
+		{"Point", "struct Point"},
+		{"Point(1, 2).sum", "method Point.sum"},
+	}
+
+	for _, tt := range inspected {
+		evaluated := testEval(declaration + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %q. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -366,6 +770,36 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let x = 1; let f = fn() { let y = x; let x = 2; y + x }; f()", 3},
+		{"let f = fn(x) { let g = fn() { x + y }; let y = 10; g() }; f(1)", 11},
+		{"let f = fn(x) { let x = x * 2; x }; f(4)", 8},
+		{"let f = fn(a) { if (a) { let b = 1 } else { let b = 2 }; b }; f(false)", 2},
+		{"let f = fn(a) { if (a) { let b = 1 }; b }; f(false)", "identifier b is undefined"},
+		{"let f = fn() { let g = fn() { y }; let r = g(); let y = 1; r }; f()", "identifier y is undefined"},
+		{"let f = fn() { y = 1; let y = 2 }; f()", "assign to an undefined identifier y"},
+		{"let adder = fn(a) { fn(b) { fn(c) { a + b + c } } }; adder(1)(2)(3)", 6},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); c()", 2},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)", 55},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(4)", true},
+		{"y", "identifier y is undefined"},
+		{"y; let y = 1", "identifier y is undefined"},
+		{"let f = fn() { self }", "identifier self is undefined"},
+		{"let x = 1; let f = fn() { fn() { x } }; let y = f()(); y", 1},
+		{"let a = 1; let a = 2", "identifier a is already declared"},
+		{"let f = fn() { let a = 1; if (a) { let a = 2 }; let a = 3 }", "identifier a is already declared"},
+		{"b = 1", "assign to an undefined identifier b"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestBuiltinFunction(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -374,6 +808,8 @@ func TestBuiltinFunction(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments, got=2, want=1"},
 	}
@@ -398,6 +834,403 @@ func TestBuiltinFunction(t *testing.T) {
 	}
 }
 
+// TestBuiltinArities checks the arities known to tools against the checks
+// the builtins make when called
+func TestBuiltinArities(t *testing.T) {
+	for _, set := range builtinSets {
+		for name, builtin := range set {
+			arity, ok := BuiltinArity(name)
+			if !ok {
+				t.Errorf("builtin %s has no arity", name)
+				continue
+			}
+
+			counts := []int{arity.Max + 1}
+			if arity.Max < 0 {
+				counts = nil
+			}
+			if arity.Min > 0 {
+				counts = append(counts, arity.Min-1)
+			}
+			for _, n := range counts {
+				args := make([]object.Object, n)
+				for i := range args {
+					args[i] = &object.Integer{Value: 1}
+				}
+				result := builtin.Fn(object.NewEnvironment(), args...)
+				errObj, ok := result.(*object.Error)
+				if !ok || !strings.HasPrefix(errObj.Message, "wrong number of arguments") {
+					t.Errorf("%s with %d arguments should fail its arity check, got=%s", name, n, result.Inspect())
+				}
+			}
+		}
+	}
+
+	for name := range arities {
+		if !IsBuiltin(name) {
+			t.Errorf("arity given for %s, which is not a builtin", name)
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []any{2, 4, 6}},
+		{`map(["a", "bc"], len)`, []any{1, 2}},
+		{`map({"a": 1}, fn(k, v) { k + string(v) })`, []any{"a1"}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []any{3, 4}},
+		{`filter({"a": 1, "b": 2}, fn(k, v) { v > 1 }).b`, 2},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], 5, fn(acc, x) { acc + x })`, 5},
+		{`let total = 0; each([1, 2], fn(x) { total = total + x }); total`, 3},
+		{`find([1, 2, 3, 4], fn(x) { x > 2 })`, 3},
+		{`find([1, 2], fn(x) { x > 2 })`, nil},
+		{`find({"a": 1}, fn(k, v) { k == "a" })`, 1},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, true},
+		{`any([], fn(x) { true })`, false},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, true},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, false},
+		{`zip([1, 2, 3], ["a", "b"])`, []any{[]any{1, "a"}, []any{2, "b"}}},
+		{`flatten([1, [2, [3]], []])`, []any{1, 2, []any{3}}},
+		{`flatten([1, [2, [3]]], 2)`, []any{1, 2, 3}},
+		{`reverse([1, 2, 3])`, []any{3, 2, 1}},
+		{`reverse("abc")`, "cba"},
+		{`sort([3, 1, 2])`, []any{1, 2, 3}},
+		{`sort(["b", "c", "a"])`, []any{"a", "b", "c"}},
+		{`sort_by(["ccc", "a", "bb"], len)`, []any{"a", "bb", "ccc"}},
+		{`sort_by([[2, "a"], [1, "b"], [2, "c"]], first)`, []any{[]any{1, "b"}, []any{2, "a"}, []any{2, "c"}}},
+		{`unique([1, 2, 1, "a", "a", 3])`, []any{1, 2, "a", 3}},
+		{`unique([[1], [2], [1], 1])`, []any{[]any{1}, []any{2}, 1}},
+		{`sort([[2, 1], [1, 5], [1]])`, []any{[]any{1}, []any{1, 5}, []any{2, 1}}},
+		{`group_by([1, 2, 3, 4, 5], fn(x) { x - x / 2 * 2 })[1]`, []any{1, 3, 5}},
+		{`group_by(["a", "bb", "cc"], len)[2]`, []any{"bb", "cc"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestCollectionBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map(1, len)`, "argument to `map` not supported, got INTEGER"},
+		{`map([1], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`map([1], len)`, "argument to `len` not supported, got INTEGER"},
+		{`map([1], 1)`, "not a function: INTEGER"},
+		{`filter([1, 2], fn(x) { y })`, "identifier y is undefined"},
+		{`reduce([1], 0, fn(acc) { acc })`, ""},
+		{`reduce([1], 0, fn(acc, x, z) { acc })`, "function call is missing parameters: z"},
+		{`sort([1, "a"])`, "unable to compare STRING and INTEGER"},
+		{`sort([[], [1], ["a"]])`, "unable to compare STRING and INTEGER"},
+		{`sort_by([1, 2, 3], fn(x) { [[], [1], ["a"]][x - 1] })`, "unable to compare STRING and INTEGER"},
+		{`group_by([1], fn(x) { [x] })`, "unusable as hash key: ARRAY"},
+		{`zip([1], 2)`, "argument to `zip` not supported, got INTEGER"},
+		{`flatten()`, "wrong number of arguments, got=0, want=1 or 2"},
+		{`flatten([1], 1, 2)`, "wrong number of arguments, got=3, want=1 or 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if tt.expected == "" {
+			if isError(evaluated) {
+				t.Errorf("unexpected error for %q: %s", tt.input, evaluated.Inspect())
+			}
+			continue
+		}
+		testErrorObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`split("a,b,,c", ",")`, []any{"a", "b", "", "c"}},
+		{`split("  one two\tthree ")`, []any{"one", "two", "three"}},
+		{`split("añb", "")`, []any{"a", "ñ", "b"}},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([1, true, "x"])`, "1truex"},
+		{`trim("  hi\n ")`, "hi"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`trim_left("  hi  ")`, "hi  "},
+		{`trim_right("  hi  ")`, "  hi"},
+		{`trim_right("hi!?", "?!")`, "hi"},
+		{`upper("ñandú")`, "ÑANDÚ"},
+		{`lower("ÀB")`, "àb"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "dog")`, false},
+		{`starts_with("monkey", "mon")`, true},
+		{`ends_with("monkey", "mon")`, false},
+		{`index_of("héllo", "llo")`, 2},
+		{`index_of("hello", "z")`, -1},
+		{`replace("a-b-c", "-", "+")`, "a+b-c"},
+		{`replace_all("a-b-c", "-", "+")`, "a+b+c"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`pad_left("ñ", 3)`, "  ñ"},
+		{`pad_right("ab", 4, ".")`, "ab.."},
+		{`pad_right("abcdef", 4)`, "abcdef"},
+		{`chars("añ😀")`, []any{"a", "ñ", "😀"}},
+		{`chars("")`, []any{}},
+		{`lines("one\r\ntwo\n\nthree\n")`, []any{"one", "two", "", "three"}},
+		{`lines("")`, []any{}},
+		{`substring("héllo", 1, 3)`, "él"},
+		{`substring("héllo", 2)`, "llo"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestStringBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split(1, ",")`, "argument to `split` not supported, got INTEGER"},
+		{`join("abc", ",")`, "argument to `join` not supported, got STRING"},
+		{`upper()`, "wrong number of arguments, got=0, want=1"},
+		{`split()`, "wrong number of arguments, got=0, want=1 or 2"},
+		{`trim("a", "b", "c")`, "wrong number of arguments, got=3, want=1 or 2"},
+		{`substring("abc")`, "wrong number of arguments, got=1, want=2 or 3"},
+		{`pad_left("a")`, "wrong number of arguments, got=1, want=2 or 3"},
+		{`contains("abc", 1)`, "argument to `contains` not supported, got INTEGER"},
+		{`repeat("a", -1)`, "count of `repeat` must not be negative, got -1"},
+		{`repeat("ab", 4611686018427387904)`, "count of `repeat` is too large, got 4611686018427387904"},
+		{`pad_left("a", 9223372036854775807)`, "width of `pad_left` is too large, got 9223372036854775807"},
+		{`pad_right("a", 100000000)`, "width of `pad_right` is too large, got 100000000"},
+		{`pad_left("a", 20000000, "😀")`, "width of `pad_left` is too large, got 20000000"},
+		{`pad_left("a", 3, "ab")`, "padding of `pad_left` must be a single character, got \"ab\""},
+		{`substring("abc", 2, 5)`, "substring out of range [2:5] with length 3"},
+		{`substring("abc", "a")`, "indexes of `substring` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testErrorObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`len({})`, 0},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`keys({"b": 2, "a": 1, "c": 3})`, []any{"b", "a", "c"}},
+		{`keys({3: 0, 1: 0, true: 0, "x": 0})`, []any{3, 1, true, "x"}},
+		{`values({"b": 2, "a": 1, "c": 3})`, []any{2, 1, 3}},
+		{`entries({"b": 2, "a": 1})`, []any{[]any{"b", 2}, []any{"a", 1}}},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`get({"a": 1}, "a")`, 1},
+		{`get({"a": 1}, "b")`, nil},
+		{`get({"a": 1}, "b", 5)`, 5},
+		{`keys(delete({"a": 1, "b": 2}, "a"))`, []any{"b"}},
+		{`let h = {"a": 1}; delete(h, "a"); h.a`, 1},
+		{`keys(merge({"a": 1}, {"b": 2}, {"c": 3}))`, []any{"a", "b", "c"}},
+		{`merge({"a": 1, "b": 1}, {"b": 2}).b`, 2},
+		{`values(map_values({"a": 1, "b": 2}, fn(v) { v * 10 }))`, []any{10, 20}},
+		{`map({"b": 2, "a": 1}, fn(k, v) { k })`, []any{"b", "a"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestHashBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys([1])`, "argument to `keys` not supported, got ARRAY"},
+		{`has({}, [1])`, "unusable as hash key: ARRAY"},
+		{`merge({}, 1)`, "argument to `merge` not supported, got INTEGER"},
+		{`get({})`, "wrong number of arguments, got=1, want=2 or 3"},
+		{`map_values({"a": 1}, fn(v) { v + "" })`, "type mismatch: INTEGER + STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testErrorObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	tests := []struct {
+		input          string
+		stdin          string
+		expected       any
+		expectedOut    string
+		expectedErrOut string
+	}{
+		{`puts("hello", 1)`, "", nil, "hello\n1\n", ""},
+		{`print("hello", 1); print(true)`, "", nil, "hello1true", ""},
+		{`eprint("oops")`, "", nil, "", "oops"},
+		{`printf("%d: %s %t\n", 1, "one", true)`, "", nil, "1: one true\n", ""},
+		{`sprintf("%05d|%-4s|", 42, "ab")`, "", "00042|ab  |", "", ""},
+		{`sprintf("%d")`, "", "%!d(MISSING)", "", ""},
+		{`input("name? ")`, "monkey\nignored\n", "monkey", "name? ", ""},
+		{`input(); input()`, "one\r\ntwo", "two", "", ""},
+		{`input()`, "", nil, "", ""},
+		{`sprintf(1)`, "", "format must be STRING, got INTEGER", "", ""},
+	}
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		for _, tt := range tests {
+			var out, errOut strings.Builder
+			env := object.NewEnvironment()
+			env.SetIO(strings.NewReader(tt.stdin), &out, &errOut)
+
+			evaluated := testEvalOn(b, tt.input, env)
+			switch expected := tt.expected.(type) {
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					testErrorObject(t, errObj, expected)
+				} else {
+					testStringObject(t, evaluated, expected)
+				}
+			case nil:
+				testNullObject(t, evaluated)
+			}
+
+			if out.String() != tt.expectedOut {
+				t.Errorf("wrong output for %q, got=%q, want=%q", tt.input, out.String(), tt.expectedOut)
+			}
+			if errOut.String() != tt.expectedErrOut {
+				t.Errorf("wrong error output for %q, got=%q, want=%q", tt.input, errOut.String(), tt.expectedErrOut)
+			}
+		}
+	})
+}
+
+func TestFormatBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("plain")`, "plain"},
+		{`format("%d%%", 50)`, "50%"},
+		{`format("[%5d][%-5d][%05d]", 42, 42, 42)`, "[   42][42   ][00042]"},
+		{`format("[%6s][%-6s][%.2s]", "abc", "abc", "abc")`, "[   abc][abc   ][ab]"},
+		{`format("%x %X %x", 255, 255, "hi")`, "ff FF 6869"},
+		{`format("%.2f|%8.3f", 3, 2)`, "3.00|   2.000"},
+		{`format("%q", "say \"hi\"")`, `"say \"hi\""`},
+		{`format("%t", true)`, "true"},
+		{`format("%s %s", 1, [1, "a"])`, "1 [1, a]"},
+		{`format("%v", [1, "a", [true]])`, `[1, "a", [true]]`},
+		{`format("%v", {"a": [1]})`, `{"a": [1]}`},
+		{`format("%#v", [1, {"a": 2}])`, "[\n  1,\n  {\n    \"a\": 2,\n  },\n]"},
+		{`format("[%-8v]", [1, 2])`, "[[1, 2]  ]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testStringObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFormatBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("%d", "one")`, "format: %d expects INTEGER, got STRING"},
+		{`format("%5.1f", true)`, "format: %5.1f expects INTEGER, got BOOLEAN"},
+		{`format("%x", [])`, "format: %x expects INTEGER or STRING, got ARRAY"},
+		{`format("%q", 1)`, "format: %q expects STRING, got INTEGER"},
+		{`format("%d %d", 1)`, "format: missing argument for %d"},
+		{`format("%d", 1, 2)`, "format: too many arguments, got=2, want=1"},
+		{`format("%z", 1)`, "format: unknown verb %z"},
+		{`format("100%")`, "format: missing verb at end of \"100%\""},
+		{`format()`, "wrong number of arguments, got=0, want at least 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testErrorObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Unregister("puts")
+	registry.Register("double", func(env *object.Environment, args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+	registry.Register("math.square", func(env *object.Environment, args ...object.Object) object.Object {
+		value := args[0].(*object.Integer).Value
+		return &object.Integer{Value: value * value}
+	})
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`double(4)`, 8},
+		{`math.square(3)`, 9},
+		{`let square = math.square; square(4)`, 16},
+		{`len("four")`, 4},
+		{`puts("hello")`, "identifier puts is undefined"},
+		{`math.cube(3)`, "identifier math.cube is undefined"},
+	}
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		for _, tt := range tests {
+			env := object.NewEnvironmentWithRegistry(registry)
+			evaluated := testEvalOn(b, tt.input, env)
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case string:
+				testErrorObject(t, evaluated, expected)
+			}
+		}
+	})
+
+	// Other interpreters keep using the standard builtins
+	testErrorObject(t, testEval(`double(4)`), "identifier double is undefined")
+}
+
+func TestRestrictedRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("math.square", func(env *object.Environment, args ...object.Object) object.Object { return NULL })
+	registry.Register("math.cube", func(env *object.Environment, args ...object.Object) object.Object { return NULL })
+	sandbox := registry.Restrict("len", "math.cube")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`puts(1)`, "identifier puts is undefined"},
+		{`math.square(1)`, "identifier math.square is undefined"},
+	}
+	forEachBackend(t, func(t *testing.T, b backend) {
+		for _, tt := range tests {
+			env := object.NewEnvironmentWithRegistry(sandbox)
+			testErrorObject(t, testEvalOn(b, tt.input, env), tt.expected)
+		}
+
+		env := object.NewEnvironmentWithRegistry(sandbox)
+		testIntegerObject(t, testEvalOn(b, `len("abc")`, env), 3)
+		testNullObject(t, testEvalOn(b, `math.cube(1)`, env))
+	})
+}
+
 func TestErrorHandlig(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -450,6 +1283,10 @@ func TestErrorHandlig(t *testing.T) {
 			"foo = 1",
 			"assign to an undefined identifier foo",
 		},
+		{
+			"let zero = 0; 5 / zero",
+			"division by zero: 5 / 0",
+		},
 		{
 			`"hello" - "world"`,
 			"unknown operator: STRING - STRING",
@@ -469,13 +1306,180 @@ func TestErrorHandlig(t *testing.T) {
 	}
 }
 
-func testEval(input string) object.Object {
+// TestCallDepth checks that both backends allow MaxCallDepth calls in
+// progress and fail with a stack overflow beyond
+func TestCallDepth(t *testing.T) {
+	count := "let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; "
+
+	testIntegerObject(t, testEval(fmt.Sprintf("%scount(%d)", count, MaxCallDepth-1)), MaxCallDepth-1)
+
+	for _, input := range []string{
+		fmt.Sprintf("%scount(%d)", count, MaxCallDepth),
+		count + "count(100000)",
+		"let f = fn() { f() }; f()",
+	} {
+		evaluated := testEval(input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Message != "stack overflow" {
+			t.Errorf("%q: expected a stack overflow, got=%s", input, evaluated.Inspect())
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/strings.m": `
+		import "join.m" as j
+		export let shout = fn(s) { j.join([s, "!"]) };
+		let hidden = 1;`,
+		"lib/join.m": `
+		puts("loading join")
+		export let join = fn(parts) { reduce(parts, "", fn(acc, x) { acc + x }) };
+		export struct Pair { first, second }`,
+		"vendor/answer.m": "export let answer = 42;",
+		"cycle/a.m":       `import "b.m" as b;`,
+		"cycle/b.m":       `import "a.m" as a;`,
+		"broken.m":        "export let = 1;",
+		"failing.m":       "export let x = 1 + true;",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`import "lib/strings.m" as s; s.shout("hi")`, "hi!"},
+		{`import "lib/join.m" as j; j.join(["a", "b"])`, "ab"},
+		{`import "lib/join.m" as j; j.Pair(1, 2).second`, 2},
+		{`import "lib/strings.m" as s; import "lib/strings.m" as t; s.shout == t.shout`, true},
+		{`import "answer.m" as a; a.answer`, 42},
+		{`export let x = 5; x`, 5},
+		{`import "lib/strings.m" as s; s.hidden`, "identifier s.hidden is undefined"},
+		{`import "lib/strings.m" as s; s.j`, "identifier s.j is undefined"},
+		{`import "missing.m" as m`, `module "missing.m" not found`},
+		{`import "lib" as l`, `module "lib" not found`},
+		{`import "broken.m" as b`, "parse errors in module " + path("broken.m") +
+			":\n\texpected next token to be IDENT, got = instead\n\tno prefix parse function for = found"},
+		{`import "failing.m" as f`, "in module " + path("failing.m") + ": type mismatch: INTEGER + BOOLEAN"},
+		{`import "cycle/a.m" as a`, "in module " + path("cycle/a.m") + ": in module " + path("cycle/b.m") +
+			": import cycle: " + path("cycle/a.m") + " -> " + path("cycle/b.m") + " -> " + path("cycle/a.m")},
+	}
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		for _, tt := range tests {
+			env := newModuleTestEnvironment(dir)
+			evaluated := testEvalOn(b, tt.input, env)
+			testExpectedObject(t, evaluated, tt.expected)
+		}
+
+		// every module is evaluated once per interpreter, however often imported
+		env := newModuleTestEnvironment(dir)
+		var out strings.Builder
+		env.SetIO(strings.NewReader(""), &out, &out)
+		evaluated := testEvalOn(b, `
+		import "lib/join.m" as a;
+		import "lib/strings.m" as s;
+		import "lib/join.m" as b;
+		b.join == a.join`, env)
+		testBooleanObject(t, evaluated, true)
+		if out.String() != "loading join\n" {
+			t.Errorf("module evaluated more than once. output=%q", out.String())
+		}
+	})
+}
+
+func newModuleTestEnvironment(dir string) *object.Environment {
 	env := object.NewEnvironment()
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
+	env.SetFile(filepath.Join(dir, "main.m"))
+	env.SetImports(object.NewImports(filepath.Join(dir, "vendor")))
+	env.SetIO(strings.NewReader(""), io.Discard, io.Discard)
+	return env
+}
+
+// writeModules writes files, keyed by their relative path, to a temporary
+// directory and returns it
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
 
+// backend runs a parsed program. The tests run their inputs on every
+// backend, the evaluator being the reference the others must agree with.
+type backend struct {
+	name string
+	eval func(program *ast.Program, env *object.Environment) object.Object
+}
+
+var backends = []backend{{"evaluator", func(program *ast.Program, env *object.Environment) object.Object {
 	return Eval(program, env)
+}}}
+
+// AddBackend registers a backend for the tests. It is called by the external
+// tests of backends_test.go, which can import the packages depending on the
+// evaluator.
+func AddBackend(name string, eval func(program *ast.Program, env *object.Environment) object.Object) {
+	backends = append(backends, backend{name: name, eval: eval})
+}
+
+// testEval runs input on every backend and returns the result of the
+// evaluator, or an error describing the first backend that disagrees with it
+func testEval(input string) object.Object {
+	program := testParse(input)
+	if errors := resolver.New(Defined(object.NewEnvironment())).Resolve(program); len(errors) > 0 {
+		return testResolveError(errors)
+	}
+	expected := backends[0].eval(program, object.NewEnvironment())
+	for _, b := range backends[1:] {
+		result := b.eval(program, object.NewEnvironment())
+		if result.Type() != expected.Type() || result.Inspect() != expected.Inspect() {
+			return &object.Error{Message: fmt.Sprintf("%s returned %s %q, %s returned %s %q", b.name,
+				result.Type(), result.Inspect(), backends[0].name, expected.Type(), expected.Inspect())}
+		}
+	}
+	return expected
+}
+
+// testEvalWithEnv runs input in env with the evaluator alone, as env keeps
+// the state of the run. Use testEvalOn to run on every backend.
+func testEvalWithEnv(input string, env *object.Environment) object.Object {
+	return testEvalOn(backends[0], input, env)
+}
+
+func testEvalOn(b backend, input string, env *object.Environment) object.Object {
+	program := testParse(input)
+	if errors := resolver.New(Defined(env)).Resolve(program); len(errors) > 0 {
+		return testResolveError(errors)
+	}
+	return b.eval(program, env)
+}
+
+// testResolveError reports the errors of the resolver as an error object, the
+// way the backends report runtime errors
+func testResolveError(errors []string) *object.Error {
+	return &object.Error{Message: strings.Join(errors, "\n")}
+}
+
+// forEachBackend runs f as a subtest for every backend
+func forEachBackend(t *testing.T, f func(t *testing.T, b backend)) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) { f(t, b) })
+	}
+}
+
+func testParse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -523,6 +1527,29 @@ func testStringObject(t *testing.T, obj object.Object, expected string) bool {
 	return true
 }
 
+// testExpectedObject checks obj against an int, string, bool, []any or nil
+// expectation. A string is compared with the message of obj when it's an error.
+func testExpectedObject(t *testing.T, obj object.Object, expected any) bool {
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case string:
+		if isError(obj) {
+			return testErrorObject(t, obj, expected)
+		}
+		return testStringObject(t, obj, expected)
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case []any:
+		return testArrayObject(t, obj, expected)
+	case nil:
+		return testNullObject(t, obj)
+	default:
+		t.Errorf("unsupported expectation %T", expected)
+		return false
+	}
+}
+
 func testArrayObject(t *testing.T, obj object.Object, expected []any) bool {
 	result, ok := obj.(*object.Array)
 	if !ok {
@@ -530,23 +1557,40 @@ func testArrayObject(t *testing.T, obj object.Object, expected []any) bool {
 		return false
 	}
 
-	if len(result.Elements) != len(expected) {
-		t.Errorf("array has wrong number of elements, got=%d, want=%d ", len(result.Elements), len(expected))
+	if result.Len() != len(expected) {
+		t.Errorf("array has wrong number of elements, got=%d, want=%d ", result.Len(), len(expected))
 		return false
 	}
 
-	for i, el := range result.Elements {
-		switch expected := expected[i].(type) {
-		case int:
-			testIntegerObject(t, el, int64(expected))
-		case string:
-			testStringObject(t, el, expected)
-		}
+	for i, el := range result.Elements() {
+		testExpectedObject(t, el, expected[i])
 	}
 
 	return true
 }
 
+func testObjectEqual(t *testing.T, obj object.Object, expected object.Object) bool {
+	if !object.Equal(obj, expected) {
+		t.Errorf("object is not equal to %s, got=%s", expected.Inspect(), obj.Inspect())
+		return false
+	}
+	return true
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error, got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if errObj.Message != expected {
+		t.Errorf("wrong error message, expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	result, ok := obj.(*object.Null)
 	if !ok {
@@ -560,3 +1604,66 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+// buildArray evaluates to an array of n integers built one push at a time
+func buildArray(n int) string {
+	return fmt.Sprintf("reduce([0] * %d, [], fn(acc, x) { push(acc, len(acc)) })", n)
+}
+
+func BenchmarkPushBuild(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkEval(b, buildArray(n), object.NewEnvironment)
+		})
+	}
+}
+
+// BenchmarkCopyingPushBuild builds the same arrays with a push that copies
+// every element, as arrays backed by plain slices had to. Its cost grows
+// quadratically, which makes 100000 elements take minutes.
+func BenchmarkCopyingPushBuild(b *testing.B) {
+	registry := NewRegistry()
+	registry.Register("push", func(env *object.Environment, args ...object.Object) object.Object {
+		elements := args[0].(*object.Array).Elements()
+		return object.NewArray(append(elements, args[1]))
+	})
+
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkEval(b, buildArray(n), func() *object.Environment {
+				return object.NewEnvironmentWithRegistry(registry)
+			})
+		})
+	}
+}
+
+func BenchmarkHashBuild(b *testing.B) {
+	input := fmt.Sprintf("reduce(%s, {}, fn(acc, x) { acc + {x: x} })", buildArray(100000))
+	benchmarkEval(b, input, object.NewEnvironment)
+}
+
+func BenchmarkTailTraversal(b *testing.B) {
+	input := fmt.Sprintf(`
+	let count = fn(arr, n) { if (len(arr) == 0) { n } else { count(tail(arr), n + 1) } };
+	count(%s, 0)
+	`, buildArray(10000))
+	benchmarkEval(b, input, object.NewEnvironment)
+}
+
+// benchmarkEval runs input on the evaluator alone, parsing and resolving it
+// once so only the evaluation is measured. The machine has benchmarks of its
+// own in the vm package.
+func benchmarkEval(b *testing.B, input string, newEnv func() *object.Environment) {
+	b.Helper()
+
+	program := testParse(input)
+	if errors := resolver.New(Defined(newEnv())).Resolve(program); len(errors) > 0 {
+		b.Fatalf("resolver has errors: %v", errors)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if result := Eval(program, newEnv()); isError(result) {
+			b.Fatalf("evaluation failed: %s", result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+// formatDirective is a single %-directive of a format string
+type formatDirective struct {
+	flags     string
+	width     string
+	precision string
+	verb      byte
+}
+
+func (d formatDirective) String() string {
+	var out strings.Builder
+	out.WriteByte('%')
+	out.WriteString(d.flags)
+	out.WriteString(d.width)
+	if d.precision != "" {
+		out.WriteByte('.')
+		out.WriteString(d.precision)
+	}
+	out.WriteByte(d.verb)
+	return out.String()
+}
+
+// goSpec returns the directive with verb replaced, ready to be handed to fmt
+func (d formatDirective) goSpec(verb byte) string {
+	d.verb = verb
+	return d.String()
+}
+
+// formatObjects renders args according to format. Supported verbs are
+// %d %s %v %x %X %f %q and %t, each accepting the -, +, 0, space and # flags,
+// a width and a precision. %% prints a literal percent sign.
+func formatObjects(format string, args []object.Object) (string, *object.Error) {
+	var out strings.Builder
+	argIndex := 0
+
+	for i := 0; i < len(format); i++ {
+		ch := format[i]
+		if ch != '%' {
+			out.WriteByte(ch)
+			continue
+		}
+
+		directive, next, err := parseFormatDirective(format, i+1)
+		if err != nil {
+			return "", err
+		}
+		i = next
+
+		if directive.verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if argIndex >= len(args) {
+			return "", newError("format: missing argument for %s", directive)
+		}
+		formatted, err := formatObject(directive, args[argIndex])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(formatted)
+		argIndex++
+	}
+
+	if argIndex < len(args) {
+		return "", newError("format: too many arguments, got=%d, want=%d", len(args), argIndex)
+	}
+	return out.String(), nil
+}
+
+// parseFormatDirective reads the directive starting right after a % sign and
+// returns it along the index of its verb
+func parseFormatDirective(format string, start int) (formatDirective, int, *object.Error) {
+	var directive formatDirective
+	i := start
+
+	for i < len(format) && strings.IndexByte("-+0 #", format[i]) >= 0 {
+		i++
+	}
+	directive.flags = format[start:i]
+
+	widthStart := i
+	for i < len(format) && isDigitByte(format[i]) {
+		i++
+	}
+	directive.width = format[widthStart:i]
+
+	if i < len(format) && format[i] == '.' {
+		i++
+		precisionStart := i
+		for i < len(format) && isDigitByte(format[i]) {
+			i++
+		}
+		directive.precision = format[precisionStart:i]
+		if directive.precision == "" {
+			directive.precision = "0"
+		}
+	}
+
+	if i >= len(format) {
+		return directive, i, newError("format: missing verb at end of %q", format)
+	}
+	directive.verb = format[i]
+	return directive, i, nil
+}
+
+func formatObject(directive formatDirective, arg object.Object) (string, *object.Error) {
+	switch directive.verb {
+	case 'd':
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return "", formatTypeError(directive, arg, object.IntegerType)
+		}
+		return fmt.Sprintf(directive.String(), integer.Value), nil
+	case 'f':
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return "", formatTypeError(directive, arg, object.IntegerType)
+		}
+		return fmt.Sprintf(directive.String(), float64(integer.Value)), nil
+	case 'x', 'X':
+		switch arg := arg.(type) {
+		case *object.Integer:
+			return fmt.Sprintf(directive.String(), arg.Value), nil
+		case *object.String:
+			return fmt.Sprintf(directive.String(), arg.Value), nil
+		default:
+			return "", formatTypeError(directive, arg, object.IntegerType, object.StringType)
+		}
+	case 't':
+		boolean, ok := arg.(*object.Boolean)
+		if !ok {
+			return "", formatTypeError(directive, arg, object.BooleanType)
+		}
+		return fmt.Sprintf(directive.String(), boolean.Value), nil
+	case 'q':
+		str, ok := arg.(*object.String)
+		if !ok {
+			return "", formatTypeError(directive, arg, object.StringType)
+		}
+		return fmt.Sprintf(directive.String(), str.Value), nil
+	case 's':
+		return fmt.Sprintf(directive.goSpec('s'), arg.Inspect()), nil
+	case 'v':
+		pretty := strings.Contains(directive.flags, "#")
+		directive.flags = strings.ReplaceAll(directive.flags, "#", "")
+		return fmt.Sprintf(directive.goSpec('s'), inspectValue(arg, pretty, 0)), nil
+	default:
+		return "", newError("format: unknown verb %s", directive)
+	}
+}
+
+func formatTypeError(directive formatDirective, arg object.Object, expected ...object.ObjectType) *object.Error {
+	types := []string{}
+	for _, t := range expected {
+		types = append(types, string(t))
+	}
+	return newError("format: %s expects %s, got %s", directive, strings.Join(types, " or "), arg.Type())
+}
+
+// inspectValue returns the representation of obj used by the %v verb, where
+// strings nested inside collections are quoted. When pretty is true arrays
+// and hashes are broken into one element per line.
+func inspectValue(obj object.Object, pretty bool, depth int) string {
+	switch obj := obj.(type) {
+	case *object.Array:
+		elements := []string{}
+		for _, el := range obj.Elements() {
+			elements = append(elements, inspectNestedValue(el, pretty, depth+1))
+		}
+		return joinCollection("[", elements, "]", pretty, depth)
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range obj.Pairs() {
+			key := inspectNestedValue(pair.Key, pretty, depth+1)
+			value := inspectNestedValue(pair.Value, pretty, depth+1)
+			pairs = append(pairs, key+": "+value)
+		}
+		return joinCollection("{", pairs, "}", pretty, depth)
+	case *object.Instance:
+		fields := []string{}
+		for i, name := range obj.Struct.Fields {
+			fields = append(fields, name+": "+inspectNestedValue(obj.Values[i], pretty, depth+1))
+		}
+		return joinCollection(obj.Struct.Name+"{", fields, "}", pretty, depth)
+	case *object.Set:
+		elements := []string{}
+		for _, el := range obj.Elements() {
+			elements = append(elements, inspectNestedValue(el, pretty, depth+1))
+		}
+		return joinCollection("#{", elements, "}", pretty, depth)
+	default:
+		return obj.Inspect()
+	}
+}
+
+func inspectNestedValue(obj object.Object, pretty bool, depth int) string {
+	if str, ok := obj.(*object.String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return inspectValue(obj, pretty, depth)
+}
+
+func joinCollection(open string, elements []string, close string, pretty bool, depth int) string {
+	if !pretty || len(elements) == 0 {
+		return open + strings.Join(elements, ", ") + close
+	}
+
+	indent := strings.Repeat("  ", depth+1)
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for _, el := range elements {
+		out.WriteString(indent + el + ",\n")
+	}
+	out.WriteString(strings.Repeat("  ", depth) + close)
+	return out.String()
+}
+
+func isDigitByte(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
@@ -0,0 +1,178 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+// hashBuiltins never modify their arguments, operations such as delete and
+// merge return a new hash. Results listing pairs follow insertion order.
+var hashBuiltins = map[string]*object.Builtin{
+	"keys": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+			hash, err := hashArgument("keys", args[0])
+			if err != nil {
+				return err
+			}
+
+			keys := []object.Object{}
+			for _, pair := range hash.Pairs() {
+				keys = append(keys, pair.Key)
+			}
+			return object.NewArray(keys)
+		},
+	},
+	"values": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+			hash, err := hashArgument("values", args[0])
+			if err != nil {
+				return err
+			}
+
+			values := []object.Object{}
+			for _, pair := range hash.Pairs() {
+				values = append(values, pair.Value)
+			}
+			return object.NewArray(values)
+		},
+	},
+	"entries": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+			hash, err := hashArgument("entries", args[0])
+			if err != nil {
+				return err
+			}
+
+			entries := []object.Object{}
+			for _, pair := range hash.Pairs() {
+				entry := object.NewArray([]object.Object{pair.Key, pair.Value})
+				entries = append(entries, entry)
+			}
+			return object.NewArray(entries)
+		},
+	},
+	"has": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			hash, err := hashArgument("has", args[0])
+			if err != nil {
+				return err
+			}
+			key, err := hashKeyArgument(args[1])
+			if err != nil {
+				return err
+			}
+
+			_, ok := hash.Get(key)
+			return nativeBoolToBooleanObject(ok)
+		},
+	},
+	"get": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 2, 3)
+			}
+			hash, err := hashArgument("get", args[0])
+			if err != nil {
+				return err
+			}
+			key, err := hashKeyArgument(args[1])
+			if err != nil {
+				return err
+			}
+
+			if value, ok := hash.Get(key); ok {
+				return value
+			}
+			if len(args) == 3 {
+				return args[2]
+			}
+			return NULL
+		},
+	},
+	"delete": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			hash, err := hashArgument("delete", args[0])
+			if err != nil {
+				return err
+			}
+			key, err := hashKeyArgument(args[1])
+			if err != nil {
+				return err
+			}
+
+			result := hash.Copy()
+			result.Delete(key)
+			return result
+		},
+	},
+	"merge": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments, got=%d, want at least %d", len(args), 1)
+			}
+
+			result := object.NewHash()
+			for _, arg := range args {
+				hash, err := hashArgument("merge", arg)
+				if err != nil {
+					return err
+				}
+				for _, pair := range hash.Pairs() {
+					result.Set(pair.Key.(object.Hashable), pair.Value)
+				}
+			}
+			return result
+		},
+	},
+	"map_values": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			hash, err := hashArgument("map_values", args[0])
+			if err != nil {
+				return err
+			}
+
+			result := object.NewHash()
+			for _, pair := range hash.Pairs() {
+				value := applyFunction(env, args[1], []object.Object{pair.Value})
+				if isError(value) {
+					return value
+				}
+				result.Set(pair.Key.(object.Hashable), value)
+			}
+			return result
+		},
+	},
+}
+
+func hashArgument(name string, arg object.Object) (*object.Hash, *object.Error) {
+	hash, ok := arg.(*object.Hash)
+	if !ok {
+		return nil, newError("argument to `%s` not supported, got %s", name, arg.Type())
+	}
+	return hash, nil
+}
+
+func hashKeyArgument(arg object.Object) (object.Hashable, *object.Error) {
+	hashable, ok := arg.(object.Hashable)
+	if !ok {
+		return nil, newError("unusable as hash key: %s", arg.Type())
+	}
+	return hashable, nil
+}
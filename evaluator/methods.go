@@ -0,0 +1,49 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+// methodTables lists, for each type, the builtins that can be called with the
+// dot syntax. The receiver is passed as the first argument, so `"a".upper()`
+// is the same as `upper("a")`.
+var methodTables = map[object.ObjectType][]string{
+	object.StringType: {
+		"len", "first", "last", "tail", "reverse", "string", "int", "bool", "format",
+		"split", "trim", "trim_left", "trim_right", "upper", "lower", "contains",
+		"starts_with", "ends_with", "index_of", "replace", "replace_all", "repeat",
+		"pad_left", "pad_right", "chars", "lines", "substring",
+	},
+	object.ArrayType: {
+		"len", "first", "last", "tail", "push", "string", "join",
+		"map", "filter", "reduce", "each", "find", "any", "all", "zip", "flatten",
+		"reverse", "sort", "sort_by", "unique", "group_by",
+	},
+	object.HashType: {
+		"len", "string", "keys", "values", "entries", "has", "get", "delete", "merge",
+		"map_values", "map", "filter", "each", "find", "any", "all",
+	},
+	object.SetType: {
+		"len", "string", "map", "filter", "each", "find", "any", "all",
+	},
+	object.IntegerType: {
+		"string", "bool",
+	},
+}
+
+// lookupMethod finds the builtin behind a method of receiver, bound to it.
+// Builtins missing from the registry of env are not available as methods
+// either.
+func lookupMethod(env *object.Environment, receiver object.Object, name string) (object.Object, bool) {
+	for _, method := range methodTables[receiver.Type()] {
+		if method != name {
+			continue
+		}
+		builtin, ok := lookupBuiltin(env, name)
+		if !ok {
+			return nil, false
+		}
+		return &object.BoundMethod{Receiver: receiver, Method: builtin, Name: name}, true
+	}
+	return nil, false
+}
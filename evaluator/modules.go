@@ -0,0 +1,146 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModuleRunner runs the program of a module in env, the global environment of
+// the module, and returns its exported members or an error
+type ModuleRunner func(program *ast.Program, env *object.Environment) (map[string]object.Object, *object.Error)
+
+// evalImportStatement binds the members exported by the imported module to
+// the statement's alias
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	module := ImportModule(node.Path.Value, node.Alias.Value, env, evalModule)
+	if isError(module) {
+		return module
+	}
+	env.Set(node.Alias.Value, module)
+	return nil
+}
+
+// ImportModule returns the module found at path, named alias, running it with
+// run the first time it is imported. Each module is run once per interpreter,
+// later imports reuse the cached members.
+func ImportModule(path string, alias string, env *object.Environment, run ModuleRunner) object.Object {
+	resolved, ok := resolveImport(path, env)
+	if !ok {
+		return newError("module %q not found", path)
+	}
+
+	module, ok := env.Imports().Module(resolved)
+	if !ok {
+		loaded := loadModule(resolved, env, run)
+		if isError(loaded) {
+			return loaded
+		}
+		module = loaded.(*object.Module)
+	}
+	return &object.Module{Name: alias, Members: module.Members}
+}
+
+// evalModule is the ModuleRunner of the evaluator
+func evalModule(program *ast.Program, env *object.Environment) (map[string]object.Object, *object.Error) {
+	if result := Eval(program, env); isError(result) {
+		return nil, result.(*object.Error)
+	}
+
+	members := map[string]object.Object{}
+	for _, statement := range program.Statements {
+		export, ok := statement.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		name := export.Name().Value
+		if value, ok := env.Get(name); ok {
+			members[name] = value
+		}
+	}
+	return members, nil
+}
+
+// resolveImport looks for path next to the file being evaluated, then in the
+// directories of the search path, returning the absolute path of the first
+// file found
+func resolveImport(path string, env *object.Environment) (string, bool) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(filepath.Dir(env.File()), path)}
+		for _, dir := range env.Imports().SearchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		abs, err := filepath.Abs(candidate)
+		if err != nil {
+			continue
+		}
+		return abs, true
+	}
+	return "", false
+}
+
+// loadModule runs the file at path in a fresh module environment and caches
+// its exported members
+func loadModule(path string, env *object.Environment, run ModuleRunner) object.Object {
+	imports := env.Imports()
+	if chain, ok := imports.Begin(path); !ok {
+		for i, file := range chain {
+			chain[i] = displayPath(file)
+		}
+		return newError("import cycle: %s", strings.Join(chain, " -> "))
+	}
+
+	var module *object.Module
+	defer func() { imports.End(module) }()
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return newError("could not read module %s: %s", displayPath(path), err)
+	}
+
+	moduleEnv := object.NewModuleEnvironment(env, path)
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 {
+		errors = resolver.New(Defined(moduleEnv)).Resolve(program)
+	}
+	if len(errors) > 0 {
+		return newError("parse errors in module %s:\n\t%s", displayPath(path), strings.Join(errors, "\n\t"))
+	}
+
+	members, failure := run(program, moduleEnv)
+	if failure != nil {
+		return newError("in module %s: %s", displayPath(path), failure.Message)
+	}
+
+	module = &object.Module{Name: displayPath(path), Members: members}
+	return module
+}
+
+// displayPath shortens path relative to the working directory when it lives
+// below it
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,60 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+// The functions below give other backends, such as the virtual machine, the
+// semantics of the evaluator so every backend behaves the same way
+
+// IsTruthy reports whether obj counts as true in a condition
+func IsTruthy(obj object.Object) bool {
+	return castObjectToBoolean(obj) == TRUE
+}
+
+func InfixOperation(operator string, left object.Object, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func PrefixOperation(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func IndexOperation(left object.Object, index object.Object, env *object.Environment) object.Object {
+	return evalIndexExpression(left, index, env)
+}
+
+// SliceOperation slices left between the given bounds, nil standing for an
+// omitted bound
+func SliceOperation(left object.Object, start, end, step object.Object) object.Object {
+	return evalSlice(left, start, end, step)
+}
+
+func DotOperation(left object.Object, name string, env *object.Environment) object.Object {
+	return evalDotExpression(left, name, env)
+}
+
+// NewHash builds a hash out of elements holding each key followed by its value
+func NewHash(elements []object.Object) object.Object {
+	hash := object.NewHash()
+	for i := 0; i < len(elements); i += 2 {
+		key, ok := elements[i].(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", elements[i].Type())
+		}
+		hash.Set(key, elements[i+1])
+	}
+	return hash
+}
+
+func NewSet(elements []object.Object) object.Object {
+	return newSet(elements)
+}
+
+func ApplyFunction(env *object.Environment, fn object.Object, args []object.Object) object.Object {
+	return applyFunction(env, fn, args)
+}
+
+func LookupBuiltin(env *object.Environment, name string) (object.Object, bool) {
+	return lookupBuiltin(env, name)
+}
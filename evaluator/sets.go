@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+var setBuiltins = map[string]*object.Builtin{
+	"set": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 0, 1)
+			}
+			if len(args) == 0 {
+				return object.NewSet()
+			}
+
+			var elements []object.Object
+			switch arg := args[0].(type) {
+			case *object.Array:
+				elements = arg.Elements()
+			case *object.String:
+				for _, ch := range arg.Value {
+					elements = append(elements, &object.String{Value: string(ch)})
+				}
+			case *object.Hash:
+				for _, pair := range arg.Pairs() {
+					elements = append(elements, pair.Key)
+				}
+			case *object.Set:
+				return arg.Copy()
+			default:
+				return newError("argument to `set` not supported, got %s", arg.Type())
+			}
+			return newSet(elements)
+		},
+	},
+}
+
+// newSet builds a set out of elements, failing on the first one that cannot
+// be hashed
+func newSet(elements []object.Object) object.Object {
+	set := object.NewSet()
+	for _, el := range elements {
+		hashable, ok := el.(object.Hashable)
+		if !ok {
+			return newError("unusable as set element: %s", el.Type())
+		}
+		set.Add(hashable)
+	}
+	return set
+}
+
+// evalSetInfixExpression implements union (|), intersection (&) and
+// difference (-). Results keep the order of left followed by the new
+// elements of right.
+func evalSetInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftSet := left.(*object.Set)
+	rightSet := right.(*object.Set)
+
+	switch operator {
+	case "|":
+		result := leftSet.Copy()
+		for _, el := range rightSet.Elements() {
+			result.Add(el.(object.Hashable))
+		}
+		return result
+	case "&":
+		result := object.NewSet()
+		for _, el := range leftSet.Elements() {
+			if rightSet.Has(el.(object.Hashable)) {
+				result.Add(el.(object.Hashable))
+			}
+		}
+		return result
+	case "-":
+		result := object.NewSet()
+		for _, el := range leftSet.Elements() {
+			if !rightSet.Has(el.(object.Hashable)) {
+				result.Add(el.(object.Hashable))
+			}
+		}
+		return result
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
@@ -0,0 +1,358 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxStringLength bounds in bytes the strings built by repeating or padding,
+// so asking for a huge one is an error rather than a crash
+const maxStringLength = 1 << 26
+
+// stringBuiltins work on runes rather than bytes, so indexes and widths count
+// characters even for non ASCII text
+var stringBuiltins = map[string]*object.Builtin{
+	"split": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 1, 2)
+			}
+			values, err := stringArguments("split", args...)
+			if err != nil {
+				return err
+			}
+
+			var parts []string
+			if len(values) == 1 {
+				parts = strings.Fields(values[0])
+			} else {
+				parts = strings.Split(values[0], values[1])
+			}
+			return stringsToArray(parts)
+		},
+	},
+	"join": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 1, 2)
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `join` not supported, got %s", args[0].Type())
+			}
+			separator := ""
+			if len(args) == 2 {
+				values, err := stringArguments("join", args[1])
+				if err != nil {
+					return err
+				}
+				separator = values[0]
+			}
+
+			parts := []string{}
+			for _, el := range arr.Elements() {
+				parts = append(parts, castObjectToString(el).Value)
+			}
+			return &object.String{Value: strings.Join(parts, separator)}
+		},
+	},
+	"trim": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return trimString("trim", strings.TrimFunc, strings.Trim, args)
+		},
+	},
+	"trim_left": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return trimString("trim_left", strings.TrimLeftFunc, strings.TrimLeft, args)
+		},
+	},
+	"trim_right": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return trimString("trim_right", strings.TrimRightFunc, strings.TrimRight, args)
+		},
+	},
+	"upper": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+			values, err := stringArguments("upper", args...)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ToUpper(values[0])}
+		},
+	},
+	"lower": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+			values, err := stringArguments("lower", args...)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ToLower(values[0])}
+		},
+	},
+	"contains": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			values, err := stringArguments("contains", args...)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(strings.Contains(values[0], values[1]))
+		},
+	},
+	"starts_with": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			values, err := stringArguments("starts_with", args...)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(strings.HasPrefix(values[0], values[1]))
+		},
+	},
+	"ends_with": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			values, err := stringArguments("ends_with", args...)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(strings.HasSuffix(values[0], values[1]))
+		},
+	},
+	"index_of": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			values, err := stringArguments("index_of", args...)
+			if err != nil {
+				return err
+			}
+
+			index := strings.Index(values[0], values[1])
+			if index >= 0 {
+				index = utf8.RuneCountInString(values[0][:index])
+			}
+			return &object.Integer{Value: int64(index)}
+		},
+	},
+	"replace": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 3)
+			}
+			values, err := stringArguments("replace", args...)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.Replace(values[0], values[1], values[2], 1)}
+		},
+	},
+	"replace_all": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 3)
+			}
+			values, err := stringArguments("replace_all", args...)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ReplaceAll(values[0], values[1], values[2])}
+		},
+	},
+	"repeat": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 2)
+			}
+			values, err := stringArguments("repeat", args[0])
+			if err != nil {
+				return err
+			}
+			count, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("count of `repeat` must be %s, got %s", object.IntegerType, args[1].Type())
+			}
+			if count.Value < 0 {
+				return newError("count of `repeat` must not be negative, got %d", count.Value)
+			}
+			if len(values[0]) > 0 && count.Value > maxStringLength/int64(len(values[0])) {
+				return newError("count of `repeat` is too large, got %d", count.Value)
+			}
+			return &object.String{Value: strings.Repeat(values[0], int(count.Value))}
+		},
+	},
+	"pad_left": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return padString("pad_left", true, args)
+		},
+	},
+	"pad_right": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return padString("pad_right", false, args)
+		},
+	},
+	"chars": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+			values, err := stringArguments("chars", args...)
+			if err != nil {
+				return err
+			}
+
+			chars := []string{}
+			for _, ch := range values[0] {
+				chars = append(chars, string(ch))
+			}
+			return stringsToArray(chars)
+		},
+	},
+	"lines": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments, got=%d, want=%d", len(args), 1)
+			}
+			values, err := stringArguments("lines", args...)
+			if err != nil {
+				return err
+			}
+
+			text := strings.TrimSuffix(values[0], "\n")
+			if text == "" {
+				return stringsToArray([]string{})
+			}
+			lines := strings.Split(text, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSuffix(line, "\r")
+			}
+			return stringsToArray(lines)
+		},
+	},
+	"substring": {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 2, 3)
+			}
+			values, err := stringArguments("substring", args[0])
+			if err != nil {
+				return err
+			}
+
+			runes := []rune(values[0])
+			bounds := []int64{0, int64(len(runes))}
+			for i, arg := range args[1:] {
+				integer, ok := arg.(*object.Integer)
+				if !ok {
+					return newError("indexes of `substring` must be %s, got %s", object.IntegerType, arg.Type())
+				}
+				bounds[i] = integer.Value
+			}
+
+			start, end := bounds[0], bounds[1]
+			if start < 0 || end < start || end > int64(len(runes)) {
+				return newError("substring out of range [%d:%d] with length %d", start, end, len(runes))
+			}
+			return &object.String{Value: string(runes[start:end])}
+		},
+	},
+}
+
+// stringArguments unwraps args, failing when any of them is not a string
+func stringArguments(name string, args ...object.Object) ([]string, *object.Error) {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("argument to `%s` not supported, got %s", name, arg.Type())
+		}
+		values[i] = str.Value
+	}
+	return values, nil
+}
+
+func stringsToArray(values []string) *object.Array {
+	elements := make([]object.Object, len(values))
+	for i, value := range values {
+		elements[i] = &object.String{Value: value}
+	}
+	return object.NewArray(elements)
+}
+
+// trimString removes whitespace, or the characters of the optional second
+// argument, using the given trimming functions
+func trimString(
+	name string,
+	trimSpace func(string, func(rune) bool) string,
+	trimCutset func(string, string) string,
+	args []object.Object,
+) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 1, 2)
+	}
+	values, err := stringArguments(name, args...)
+	if err != nil {
+		return err
+	}
+
+	if len(values) == 2 {
+		return &object.String{Value: trimCutset(values[0], values[1])}
+	}
+	return &object.String{Value: trimSpace(values[0], unicode.IsSpace)}
+}
+
+// padString fills a string up to a width measured in characters, with spaces
+// or the single character given as third argument
+func padString(name string, left bool, args []object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments, got=%d, want=%d or %d", len(args), 2, 3)
+	}
+	values, err := stringArguments(name, args[0])
+	if err != nil {
+		return err
+	}
+	width, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("width of `%s` must be %s, got %s", name, object.IntegerType, args[1].Type())
+	}
+	pad := " "
+	if len(args) == 3 {
+		padValues, err := stringArguments(name, args[2])
+		if err != nil {
+			return err
+		}
+		pad = padValues[0]
+		if utf8.RuneCountInString(pad) != 1 {
+			return newError("padding of `%s` must be a single character, got %q", name, pad)
+		}
+	}
+	if width.Value > maxStringLength/int64(len(pad)) {
+		return newError("width of `%s` is too large, got %d", name, width.Value)
+	}
+
+	missing := int(width.Value) - utf8.RuneCountInString(values[0])
+	if missing <= 0 {
+		return args[0]
+	}
+	padding := strings.Repeat(pad, missing)
+	if left {
+		return &object.String{Value: padding + values[0]}
+	}
+	return &object.String{Value: values[0] + padding}
+}
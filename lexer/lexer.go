@@ -11,10 +11,15 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	line      int // line of ch, counting from 1
+	lineStart int // position of the first character of the line
+
+	comments []token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -22,18 +27,41 @@ func New(input string) *Lexer {
 func (l *Lexer) Reset() {
 	l.position = 0
 	l.readPosition = 0
+	l.ch = 0
+	l.line = 1
+	l.lineStart = 0
+	l.comments = nil
 	l.readChar()
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+// Comments returns the comments skipped so far, as token.COMMENT tokens
+// holding the text of the comment from its #
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
 
+// NextToken skips whitespace and comments and returns the next token.
+//
+// A # starts a comment running to the end of the line, except when a { follows
+// it right away: #{ opens a set literal. A comment written as #{...}, which
+// was one before sets existed, is read as a set, so such comments need a
+// space after the #.
+func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
-	for l.ch == '#' {
+	for l.ch == '#' && l.peekChar() != '{' {
 		l.skipComment()
 		l.skipWhitespace()
 	}
 
+	line, column := l.line, l.position-l.lineStart+1
+	tok := l.readToken()
+	tok.Line, tok.Column = line, column
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	// Operators
 	case '=':
@@ -73,6 +101,11 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 
+	case '|':
+		tok = newToken(token.PIPE, l.ch)
+	case '&':
+		tok = newToken(token.AMPERSAND, l.ch)
+
 	case '<':
 		tok = newToken(token.LT, l.ch)
 	case '>':
@@ -96,6 +129,11 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '#':
+		// comments were skipped above, so this is the start of a set literal
+		literal := l.readTwoCharToken('{')
+		tok.Literal = literal
+		tok.Type = token.HASHBRACE
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -126,6 +164,10 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -149,9 +191,13 @@ func (l *Lexer) skipWhitespace() {
 }
 
 func (l *Lexer) skipComment() {
+	start := l.position
+	comment := token.Token{Type: token.COMMENT, Line: l.line, Column: l.position - l.lineStart + 1}
 	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	comment.Literal = strings.TrimRight(l.input[start:l.position], " \t\r")
+	l.comments = append(l.comments, comment)
 }
 
 func (l *Lexer) readIdentifier() string {
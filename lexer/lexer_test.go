@@ -34,6 +34,10 @@ func TestNextToken(t *testing.T) {
   let a = [1, 2];
   { "foo": "bar" };
   foo.bar;
+  1 in a not in b;
+  #{1} | a & b; # not a #{set}
+  struct
+  import "lib.m" as lib; export
   `
 	tests := []struct {
 		expectedType    token.TokenType
@@ -141,6 +145,28 @@ func TestNextToken(t *testing.T) {
 		{token.DOT, "."},
 		{token.IDENT, "bar"},
 		{token.SEMICOLON, ";"},
+		{token.INT, "1"},
+		{token.IN, "in"},
+		{token.IDENT, "a"},
+		{token.NOT, "not"},
+		{token.IN, "in"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+		{token.HASHBRACE, "#{"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.PIPE, "|"},
+		{token.IDENT, "a"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+		{token.STRUCT, "struct"},
+		{token.IMPORT, "import"},
+		{token.STRING, "lib.m"},
+		{token.AS, "as"},
+		{token.IDENT, "lib"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
 		{token.EOF, ""},
 	}
 
@@ -158,3 +184,97 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let five = 5;
+# a comment
+  puts("two
+lines") == !x
+`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"five", 1, 5},
+		{"=", 1, 10},
+		{"5", 1, 12},
+		{";", 1, 13},
+		{"puts", 3, 3},
+		{"(", 3, 7},
+		{"two\nlines", 3, 8},
+		{")", 4, 7},
+		{"==", 4, 9},
+		{"!", 4, 12},
+		{"x", 4, 13},
+		{"", 5, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%d:%d, got %d:%d", i,
+				tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `# first
+let x = 1; # trailing  
+#{1} # set
+`
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "# first", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "# trailing", Line: 2, Column: 12},
+		{Type: token.COMMENT, Literal: "# set", Line: 3, Column: 6},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d (%+v)", len(expected), len(comments), comments)
+	}
+	for i, comment := range comments {
+		if comment != expected[i] {
+			t.Errorf("comments[%d] wrong. want=%+v, got=%+v", i, expected[i], comment)
+		}
+	}
+}
+
+func TestHashBraceStartsASetNotAComment(t *testing.T) {
+	input := `#{todo}
+# {todo}
+`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.HASHBRACE, "#{"},
+		{token.IDENT, "todo"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if comments := l.Comments(); len(comments) != 1 || comments[0].Literal != "# {todo}" {
+		t.Errorf("wrong comments. got=%+v", comments)
+	}
+}
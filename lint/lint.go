@@ -0,0 +1,324 @@
+// Package lint reports likely mistakes in Monkey programs without running
+// them: names that are never declared or never used, calls to builtins with
+// the wrong number of arguments and code that cannot run.
+//
+// Names are looked up the way the resolver binds them. Code runs top to
+// bottom, so a reference sees the variables declared before it, and function
+// bodies see all the variables of the function or program declaring them.
+package lint
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"sort"
+	"strings"
+)
+
+// The rules checked by the linter
+const (
+	Undefined            = "undefined"
+	UndeclaredAssignment = "undeclared-assignment"
+	UnusedVariable       = "unused-variable"
+	UnusedParameter      = "unused-parameter"
+	ShadowedBuiltin      = "shadowed-builtin"
+	Unreachable          = "unreachable"
+	BuiltinArity         = "builtin-arity"
+)
+
+// Rule describes a check of the linter
+type Rule struct {
+	Name string
+	Doc  string
+}
+
+// Rules lists every rule, all of them enabled by default
+var Rules = []Rule{
+	{Undefined, "references to names that are neither declared nor builtins"},
+	{UndeclaredAssignment, "assignments to names never declared, which fail when run"},
+	{UnusedVariable, "let bindings never read, unless exported or named with a leading _"},
+	{UnusedParameter, "parameters never read, unless named with a leading _"},
+	{ShadowedBuiltin, "declarations hiding a builtin"},
+	{Unreachable, "statements following a return"},
+	{BuiltinArity, "calls to builtins with the wrong number of arguments"},
+}
+
+// Select returns the rules to check: the ones in enable, or all of them when
+// it is empty, less the ones in disable. Unknown rule names are an error.
+func Select(enable, disable []string) (map[string]bool, error) {
+	for _, name := range append(append([]string{}, enable...), disable...) {
+		if !isRule(name) {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+	}
+
+	rules := map[string]bool{}
+	for _, rule := range Rules {
+		rules[rule.Name] = len(enable) == 0
+	}
+	for _, name := range enable {
+		rules[name] = true
+	}
+	for _, name := range disable {
+		rules[name] = false
+	}
+	return rules, nil
+}
+
+func isRule(name string) bool {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Diagnostic is a problem found by a rule in the source covered by Span
+type Diagnostic struct {
+	Rule    string
+	Span    ast.Span
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Span.Start.Line, d.Span.Start.Column, d.Message, d.Rule)
+}
+
+// Lint checks program with the given rules and returns what they report,
+// sorted by position
+func Lint(program *ast.Program, rules map[string]bool) []Diagnostic {
+	l := &linter{rules: rules, scope: &scope{vars: map[string]*variable{}}}
+	l.statements(program.Statements)
+	l.resolveFunctions()
+	l.reportUnused()
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i].Span.Start, l.diagnostics[j].Span.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return l.diagnostics
+}
+
+type variableKind int
+
+const (
+	letVariable variableKind = iota
+	parameter
+	declaration // a struct, an import or self, never reported unused
+)
+
+type variable struct {
+	ident *ast.Identifier
+	kind  variableKind
+	used  bool
+}
+
+// scope holds the variables of a function, or of the program for the
+// outermost scope. Blocks share the scope of their function.
+type scope struct {
+	outer *scope
+	vars  map[string]*variable
+	// declared lists the variables in the order of their declaration
+	declared []*variable
+
+	// functions lists the function literals to check once the scope has
+	// declared all of its variables
+	functions []function
+}
+
+type function struct {
+	literal *ast.FunctionLiteral
+	method  bool
+}
+
+type linter struct {
+	rules       map[string]bool
+	scope       *scope
+	diagnostics []Diagnostic
+}
+
+func (l *linter) statements(list []ast.Statement) {
+	l.unreachable(list)
+	for _, s := range list {
+		l.node(s)
+	}
+}
+
+// node checks node and its children, except for the bodies of functions,
+// which are left for the end of the current scope
+func (l *linter) node(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			l.node(n.Value)
+			l.declare(n.Name, letVariable)
+			return false
+		case *ast.AssignmentStatement:
+			l.node(n.Value)
+			if v, _ := l.lookup(n.Name.Value); v == nil {
+				l.report(UndeclaredAssignment, n.Name, "assignment to undeclared identifier %s", n.Name.Value)
+			}
+			return false
+		case *ast.StructStatement:
+			l.declare(n.Name, declaration)
+			for _, method := range n.Methods {
+				l.scope.functions = append(l.scope.functions, function{method.Function, true})
+			}
+			return false
+		case *ast.ImportStatement:
+			l.declare(n.Alias, declaration)
+			return false
+		case *ast.ExportStatement:
+			l.node(n.Statement)
+			if let, ok := n.Statement.(*ast.LetStatement); ok {
+				l.scope.vars[let.Name.Value].used = true
+			}
+			return false
+		case *ast.BlockStatement:
+			l.statements(n.Statements)
+			return false
+		case *ast.FunctionLiteral:
+			l.scope.functions = append(l.scope.functions, function{n, false})
+			return false
+		case *ast.DotExpression:
+			// the right side names a member, not a variable
+			l.node(n.Left)
+			return false
+		case *ast.CallExpression:
+			l.call(n)
+		case *ast.Identifier:
+			l.reference(n)
+		}
+		return true
+	})
+}
+
+// resolveFunctions checks the functions declared in the current scope,
+// which has declared all of its variables by now
+func (l *linter) resolveFunctions() {
+	for len(l.scope.functions) > 0 {
+		fn := l.scope.functions[0]
+		l.scope.functions = l.scope.functions[1:]
+		l.function(fn.literal, fn.method)
+	}
+}
+
+// function checks fn in a scope of its own. Methods receive self.
+func (l *linter) function(fn *ast.FunctionLiteral, method bool) {
+	l.scope = &scope{outer: l.scope, vars: map[string]*variable{}}
+	if method {
+		l.declare(&ast.Identifier{Value: "self"}, declaration)
+	}
+	for _, param := range fn.Parameters {
+		l.declare(param, parameter)
+	}
+
+	if fn.Body != nil {
+		l.statements(fn.Body.Statements)
+	}
+	l.resolveFunctions()
+	l.reportUnused()
+	l.scope = l.scope.outer
+}
+
+// declare adds the variable named by ident to the current scope. Declaring
+// a name again in a scope refers to the same variable.
+func (l *linter) declare(ident *ast.Identifier, kind variableKind) {
+	if evaluator.IsBuiltin(ident.Value) {
+		l.report(ShadowedBuiltin, ident, "%s shadows the builtin %s", ident.Value, ident.Value)
+	}
+	if _, ok := l.scope.vars[ident.Value]; ok {
+		return
+	}
+	v := &variable{ident: ident, kind: kind}
+	l.scope.vars[ident.Value] = v
+	l.scope.declared = append(l.scope.declared, v)
+}
+
+// lookup returns the variable named name, or nil with whether name is a
+// builtin when there is none
+func (l *linter) lookup(name string) (*variable, bool) {
+	for s := l.scope; s != nil; s = s.outer {
+		if v, ok := s.vars[name]; ok {
+			return v, false
+		}
+	}
+	return nil, evaluator.IsBuiltin(name)
+}
+
+func (l *linter) reference(ident *ast.Identifier) {
+	v, builtin := l.lookup(ident.Value)
+	switch {
+	case v != nil:
+		v.used = true
+	case !builtin:
+		l.report(Undefined, ident, "identifier %s is undefined", ident.Value)
+	}
+}
+
+// call checks the number of arguments of a call to a builtin
+func (l *linter) call(call *ast.CallExpression) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	if v, builtin := l.lookup(ident.Value); v != nil || !builtin {
+		return
+	}
+
+	arity, ok := evaluator.BuiltinArity(ident.Value)
+	if ok && !arity.Accepts(len(call.Arguments)) {
+		l.report(BuiltinArity, call, "wrong number of arguments to %s, got=%d, want=%s",
+			ident.Value, len(call.Arguments), describeArity(arity))
+	}
+}
+
+func describeArity(arity evaluator.Arity) string {
+	switch {
+	case arity.Max < 0:
+		return fmt.Sprintf("at least %d", arity.Min)
+	case arity.Min == arity.Max:
+		return fmt.Sprint(arity.Min)
+	default:
+		return fmt.Sprintf("%d to %d", arity.Min, arity.Max)
+	}
+}
+
+// unreachable reports the statements of a list following a return, which
+// ends the function or program running it
+func (l *linter) unreachable(list []ast.Statement) {
+	for i := 0; i < len(list)-1; i++ {
+		if _, ok := list[i].(*ast.ReturnStatement); ok {
+			span := ast.Span{Start: ast.SpanOf(list[i+1]).Start, End: ast.SpanOf(list[len(list)-1]).End}
+			l.reportSpan(Unreachable, span, "unreachable code after return")
+			return
+		}
+	}
+}
+
+// reportUnused reports the variables of the current scope that were never
+// read
+func (l *linter) reportUnused() {
+	for _, v := range l.scope.declared {
+		if v.used || strings.HasPrefix(v.ident.Value, "_") {
+			continue
+		}
+		switch v.kind {
+		case letVariable:
+			l.report(UnusedVariable, v.ident, "%s is declared but never used", v.ident.Value)
+		case parameter:
+			l.report(UnusedParameter, v.ident, "parameter %s is never used", v.ident.Value)
+		}
+	}
+}
+
+func (l *linter) report(rule string, node ast.Node, format string, a ...any) {
+	l.reportSpan(rule, ast.SpanOf(node), format, a...)
+}
+
+func (l *linter) reportSpan(rule string, span ast.Span, format string, a ...any) {
+	if l.rules[rule] {
+		l.diagnostics = append(l.diagnostics, Diagnostic{Rule: rule, Span: span, Message: fmt.Sprintf(format, a...)})
+	}
+}
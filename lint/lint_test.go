@@ -0,0 +1,143 @@
+package lint
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 1; puts(a)", nil},
+
+		// undefined
+		{"puts(foobar)", []string{"1:6: identifier foobar is undefined (undefined)"}},
+		{"puts(a); let a = 1; a", []string{"1:6: identifier a is undefined (undefined)"}},
+		{"let f = fn() { a }; let a = 1; f()", nil},
+		{"let f = fn(x) { x }; f(x)", []string{"1:24: identifier x is undefined (undefined)"}},
+		{"let h = {}; h.missing", nil},
+		{"fn() { self }()", []string{"1:8: identifier self is undefined (undefined)"}},
+		{"struct A { x; fn get() { self.x } } A", nil},
+
+		// undeclared assignment
+		{"b = 1", []string{"1:1: assignment to undeclared identifier b (undeclared-assignment)"}},
+		{"len = 1", []string{"1:1: assignment to undeclared identifier len (undeclared-assignment)"}},
+		{"let b = 1; fn() { b = 2 }(); b", nil},
+
+		// unused
+		{"let a = 1", []string{"1:5: a is declared but never used (unused-variable)"}},
+		{"let a = 1; a = 2", []string{"1:5: a is declared but never used (unused-variable)"}},
+		{"export let a = 1; let _b = 2", nil},
+		{"let f = fn(x, y) { x }; f(1, 2)", []string{"1:15: parameter y is never used (unused-parameter)"}},
+		{"map([1], fn(_x) { 1 })", nil},
+		{"let f = fn() { let a = 1; fn() { a } }; f", nil},
+		{"let c = 1; if (c) { let c = 2 }; c", nil},
+		{
+			"let f = fn(n) { let unused = n; n }; f(1)",
+			[]string{"1:21: unused is declared but never used (unused-variable)"},
+		},
+
+		// shadowed builtins
+		{"let len = 1; len", []string{"1:5: len shadows the builtin len (shadowed-builtin)"}},
+		{
+			"let f = fn(first) { first }; f(1)",
+			[]string{"1:12: first shadows the builtin first (shadowed-builtin)"},
+		},
+
+		// unreachable code
+		{
+			"let f = fn() { return 1; puts(2); 3 }; f()",
+			[]string{"1:26: unreachable code after return (unreachable)"},
+		},
+		{"let f = fn(x) { if (x) { return 1 }; 2 }; f(1)", nil},
+
+		// builtin arity
+		{`len("a", "b")`, []string{"1:1: wrong number of arguments to len, got=2, want=1 (builtin-arity)"}},
+		{`split()`, []string{"1:1: wrong number of arguments to split, got=0, want=1 to 2 (builtin-arity)"}},
+		{`zip([1])`, []string{"1:1: wrong number of arguments to zip, got=1, want=at least 2 (builtin-arity)"}},
+		{`puts(); puts(1, 2, 3)`, nil},
+		{"let len = fn(a, b) { a + b }; len(1, 2)", []string{"1:5: len shadows the builtin len (shadowed-builtin)"}},
+	}
+
+	for _, tt := range tests {
+		rules, _ := Select(nil, nil)
+		diagnostics := Lint(parse(t, tt.input), rules)
+		testDiagnostics(t, tt.input, diagnostics, tt.expected)
+	}
+}
+
+func TestLintSpans(t *testing.T) {
+	input := "let f = fn() {\n  return 1;\n  puts(2);\n  3\n};\nf()"
+	rules, _ := Select([]string{Unreachable}, nil)
+	diagnostics := Lint(parse(t, input), rules)
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%v", diagnostics)
+	}
+
+	expected := ast.Span{Start: ast.Position{Line: 3, Column: 3}, End: ast.Position{Line: 4, Column: 4}}
+	if diagnostics[0].Span != expected {
+		t.Errorf("wrong span. want=%+v, got=%+v", expected, diagnostics[0].Span)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	input := "let len = 1; let f = fn(x) { y }"
+
+	tests := []struct {
+		enable   []string
+		disable  []string
+		expected []string
+	}{
+		{nil, []string{ShadowedBuiltin, UnusedVariable}, []string{
+			"1:25: parameter x is never used (unused-parameter)",
+			"1:30: identifier y is undefined (undefined)",
+		}},
+		{[]string{Undefined}, nil, []string{
+			"1:30: identifier y is undefined (undefined)",
+		}},
+		{[]string{Undefined, ShadowedBuiltin}, []string{Undefined}, []string{
+			"1:5: len shadows the builtin len (shadowed-builtin)",
+		}},
+	}
+
+	for _, tt := range tests {
+		rules, err := Select(tt.enable, tt.disable)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		diagnostics := Lint(parse(t, input), rules)
+		testDiagnostics(t, strings.Join(tt.enable, ",")+" -"+strings.Join(tt.disable, ","), diagnostics, tt.expected)
+	}
+
+	if _, err := Select(nil, []string{"nope"}); err == nil || err.Error() != `unknown rule "nope"` {
+		t.Errorf("wrong error for an unknown rule. got=%v", err)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser has errors: %v", errors)
+	}
+	return program
+}
+
+func testDiagnostics(t *testing.T, name string, diagnostics []Diagnostic, expected []string) {
+	t.Helper()
+
+	got := []string{}
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("%s: wrong diagnostics.\nwant=%q\ngot =%q", name, expected, got)
+	}
+}
@@ -2,52 +2,413 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
 	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/lint"
 	"monkey/object"
+	"monkey/optimizer"
 	"monkey/parser"
+	"monkey/printer"
 	"monkey/repl"
+	"monkey/resolver"
+	"monkey/token"
+	"monkey/vm"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	strict     = flag.Bool("strict", false, "report out of range indexes as errors instead of null")
+	searchPath = flag.String("path", os.Getenv("MONKEYPATH"), "list of directories searched for imported modules")
+	optimize   = flag.Bool("O", false, "fold constants and drop dead branches before running a file")
+	backend    = flag.String("backend", "evaluator", "run programs with the tree-walking `evaluator` or the bytecode `vm`")
 )
 
 func main() {
-	args := os.Args[1:]
+	flag.Parse()
+	args := flag.Args()
 
-	if len(args) > 0 {
-		filename := args[0]
-		runFile(filename)
-	} else {
+	if *backend != "evaluator" && *backend != "vm" {
+		fmt.Printf("Unknown backend %s, want evaluator or vm\n", *backend)
+		os.Exit(2)
+	}
+
+	switch {
+	case len(args) > 0 && args[0] == "build":
+		build(args[1:])
+	case len(args) > 0 && args[0] == "tokens":
+		dumpTokens(args[1:])
+	case len(args) > 0 && args[0] == "ast":
+		dumpAST(args[1:])
+	case len(args) > 0 && args[0] == "disasm":
+		disassemble(args[1:])
+	case len(args) > 0 && args[0] == "fmt":
+		formatFiles(args[1:])
+	case len(args) > 0 && args[0] == "lint":
+		lintFiles(args[1:])
+	case len(args) > 0 && filepath.Ext(args[0]) == ".mbc":
+		runBytecode(args[0])
+	case len(args) > 0:
+		runFile(args[0])
+	default:
 		runRepl()
 	}
 }
 
 func runFile(filename string) {
+	env := newEnvironment()
+	env.SetFile(filename)
+	program, ok := parseFile(filename, env)
+	if !ok {
+		return
+	}
+
+	evaluation := newEvaluator()(program, env)
+	if err, ok := evaluation.(*object.Error); ok {
+		fmt.Println(err.Message)
+	}
+}
+
+// parseFile reads, checks and, with -O, optimizes the script in filename,
+// printing the errors found
+func parseFile(filename string, env *object.Environment) (*ast.Program, bool) {
+	program, ok := readProgram(filename)
+	if !ok {
+		return nil, false
+	}
+	if errors := resolver.New(evaluator.Defined(env)).Resolve(program); len(errors) > 0 {
+		printErrors(errors)
+		return nil, false
+	}
+
+	if *optimize {
+		optimizer.Optimize(program)
+	}
+	return program, true
+}
+
+// readProgram parses the script in filename as written, printing the errors
+// found
+func readProgram(filename string) (*ast.Program, bool) {
 	dat, err := os.ReadFile(filename)
 	if err != nil {
 		fmt.Printf("Could not open file %s\n", filename)
-		return
+		return nil, false
 	}
-	script := string(dat)
-	l := lexer.New(script)
-	p := parser.New(l)
+	p := parser.New(lexer.New(string(dat)))
 	program := p.ParseProgram()
-	errors := p.Errors()
-	if len(errors) > 0 {
-		for _, msg := range errors {
-			fmt.Println(msg)
-		}
-		return
+	if len(p.Errors()) > 0 {
+		printErrors(p.Errors())
+		return nil, false
 	}
+	return program, true
+}
 
-	env := object.NewEnvironment()
-	evaluation := evaluator.Eval(program, env)
+func printErrors(errors []string) {
+	for _, msg := range errors {
+		fmt.Println(msg)
+	}
+}
+
+// parseCommand parses the arguments of a subcommand taking a single file,
+// which its flags may follow, and returns the file
+func parseCommand(flags *flag.FlagSet, usage string, args []string) string {
+	files := parseFiles(flags, usage, args)
+	if len(files) > 1 {
+		fmt.Printf("Unexpected arguments %v\n", files[1:])
+		os.Exit(2)
+	}
+	return files[0]
+}
+
+// parseFiles parses the arguments of a subcommand taking files, the flags
+// being allowed among them, and returns the files
+func parseFiles(flags *flag.FlagSet, usage string, args []string) []string {
+	flags.Parse(args)
+	files := []string{}
+	for flags.NArg() > 0 {
+		files = append(files, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	if len(files) == 0 {
+		fmt.Println("Usage: " + usage)
+		os.Exit(2)
+	}
+	return files
+}
+
+// build compiles a script to a bytecode file run later by the virtual
+// machine without parsing it again:
+//
+//	monkey build script.m -o script.mbc
+func build(args []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "write the bytecode to `file`, the script with the .mbc extension by default")
+	filename := parseCommand(flags, "monkey build script.m [-o script.mbc]", args)
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".mbc"
+	}
+
+	env := newEnvironment()
+	env.SetFile(filename)
+	program, ok := parseFile(filename, env)
+	if !ok {
+		os.Exit(1)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Printf("Could not write file %s\n", *output)
+		os.Exit(1)
+	}
+}
+
+// runBytecode runs a file written by build on the virtual machine
+func runBytecode(filename string) {
+	bytecode, ok := loadBytecode(filename)
+	if !ok {
+		os.Exit(1)
+	}
+
+	env := newEnvironment()
+	env.SetFile(filename)
+	evaluation := vm.New(bytecode, env).Run()
 	if err, ok := evaluation.(*object.Error); ok {
 		fmt.Println(err.Message)
 	}
 }
 
+// loadBytecode reads a file written by build, printing why it cannot be run
+func loadBytecode(filename string) (*compiler.Bytecode, bool) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Printf("Could not open file %s\n", filename)
+		return nil, false
+	}
+	bytecode := &compiler.Bytecode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		fmt.Printf("Could not load %s: %s\n", filename, err)
+		return nil, false
+	}
+	return bytecode, true
+}
+
+// dumpTokens lists the tokens of a script, one per line with its position,
+// type and literal
+func dumpTokens(args []string) {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	filename := parseCommand(flags, "monkey tokens script.m", args)
+	dat, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Printf("Could not open file %s\n", filename)
+		os.Exit(1)
+	}
+
+	l := lexer.New(string(dat))
+	for {
+		tok := l.NextToken()
+		fmt.Printf("%-7s %-10s %q\n", fmt.Sprintf("%d:%d", tok.Line, tok.Column), tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			return
+		}
+	}
+}
+
+// dumpAST prints the tree parsed from a script, indented or as JSON
+func dumpAST(args []string) {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+	filename := parseCommand(flags, "monkey ast script.m [-json]", args)
+	program, ok := readProgram(filename)
+	if !ok {
+		os.Exit(1)
+	}
+
+	print := ast.Fprint
+	if *asJSON {
+		print = ast.FprintJSON
+	}
+	if err := print(os.Stdout, program); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// disassemble prints the instructions compiled from a script, or held by a
+// bytecode file
+func disassemble(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	lines := flags.Bool("lines", false, "show the line of source of every instruction")
+	filename := parseCommand(flags, "monkey disasm script.m|script.mbc [-lines]", args)
+
+	var bytecode *compiler.Bytecode
+	if filepath.Ext(filename) == ".mbc" {
+		loaded, ok := loadBytecode(filename)
+		if !ok {
+			os.Exit(1)
+		}
+		bytecode = loaded
+	} else {
+		env := newEnvironment()
+		env.SetFile(filename)
+		program, ok := parseFile(filename, env)
+		if !ok {
+			os.Exit(1)
+		}
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		bytecode = comp.Bytecode()
+	}
+	fmt.Print(bytecode.Disassemble(*lines))
+}
+
+// formatFiles prints scripts in the canonical style, or with -w rewrites
+// them. With -check it lists the scripts not formatted, exiting with status
+// 1 when there are some.
+func formatFiles(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list the files not formatted and exit with status 1 if any")
+	write := flags.Bool("w", false, "write the formatted source back to the files instead of printing it")
+	files := parseFiles(flags, "monkey fmt [-check] [-w] script.m...", args)
+
+	status := 0
+	for _, filename := range files {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Printf("Could not open file %s\n", filename)
+			status = 1
+			continue
+		}
+		formatted, err := printer.Format(src)
+		if err != nil {
+			for _, msg := range strings.Split(err.Error(), "\n") {
+				fmt.Printf("%s: %s\n", filename, msg)
+			}
+			status = 1
+			continue
+		}
+
+		changed := !bytes.Equal(src, formatted)
+		if *check && changed {
+			fmt.Println(filename)
+			status = 1
+		}
+		if *write && changed {
+			if err := os.WriteFile(filename, formatted, 0644); err != nil {
+				fmt.Printf("Could not write file %s\n", filename)
+				status = 1
+			}
+		}
+		if !*check && !*write {
+			os.Stdout.Write(formatted)
+		}
+	}
+	os.Exit(status)
+}
+
+// lintResult is a diagnostic of the linter as printed by monkey lint -json
+type lintResult struct {
+	File      string `json:"file"`
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+}
+
+// lintFiles reports the likely mistakes found in scripts, one per line
+// prefixed by the file and position, or with -json as a list of objects. The
+// errors of scripts failing to parse go to stderr. It exits with status 1
+// when anything was reported.
+func lintFiles(args []string) {
+	names := []string{}
+	for _, rule := range lint.Rules {
+		names = append(names, rule.Name)
+	}
+
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the diagnostics as JSON")
+	enable := flags.String("enable", "", "comma-separated `rules` to check instead of all of "+strings.Join(names, ", "))
+	disable := flags.String("disable", "", "comma-separated `rules` not to check")
+	files := parseFiles(flags, "monkey lint [-json] [-enable rules] [-disable rules] script.m...", args)
+
+	rules, err := lint.Select(splitList(*enable), splitList(*disable))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	status := 0
+	results := []lintResult{}
+	for _, filename := range files {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not open file %s\n", filename)
+			status = 1
+			continue
+		}
+		p := parser.New(lexer.New(string(src)))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			for _, msg := range p.Errors() {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", filename, msg)
+			}
+			status = 1
+			continue
+		}
+
+		for _, d := range lint.Lint(program, rules) {
+			results = append(results, lintResult{
+				File: filename, Rule: d.Rule, Message: d.Message,
+				Line: d.Span.Start.Line, Column: d.Span.Start.Column,
+				EndLine: d.Span.End.Line, EndColumn: d.Span.End.Column,
+			})
+		}
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Printf("%s\n", out)
+	} else {
+		for _, r := range results {
+			fmt.Printf("%s:%d:%d: %s (%s)\n", r.File, r.Line, r.Column, r.Message, r.Rule)
+		}
+	}
+	if len(results) > 0 {
+		status = 1
+	}
+	os.Exit(status)
+}
+
+// splitList splits a comma-separated list, empty when s is
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
 func runRepl() {
 	user, err := user.Current()
 	if err != nil {
@@ -55,5 +416,23 @@ func runRepl() {
 	}
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.RunWith(os.Stdin, os.Stdout, newEnvironment(), newEvaluator())
+}
+
+// newEvaluator returns the backend chosen with the -backend flag. The virtual
+// machine keeps its globals from one program to the next, as the REPL needs.
+func newEvaluator() repl.Evaluator {
+	if *backend == "vm" {
+		return vm.NewSession().Eval
+	}
+	return func(program *ast.Program, env *object.Environment) object.Object {
+		return evaluator.Eval(program, env)
+	}
+}
+
+func newEnvironment() *object.Environment {
+	env := object.NewEnvironment()
+	env.SetOptions(&object.Options{StrictIndexing: *strict})
+	env.SetImports(object.NewImports(filepath.SplitList(*searchPath)...))
+	return env
 }
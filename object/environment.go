@@ -1,12 +1,86 @@
 package object
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
 )
 
+// Stdio holds the streams builtins read from and print to
+type Stdio struct {
+	In  *bufio.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+var defaultStdio = &Stdio{
+	In:  bufio.NewReader(os.Stdin),
+	Out: os.Stdout,
+	Err: os.Stderr,
+}
+
+// Options tune the behaviour of the interpreter
+type Options struct {
+	// StrictIndexing makes out of range indexes an error instead of null
+	StrictIndexing bool
+}
+
+var defaultOptions = &Options{}
+
+// Imports caches the modules loaded by an interpreter by their absolute path
+// and tracks the ones being loaded to detect import cycles
+type Imports struct {
+	// SearchPath lists the directories searched for modules that are not
+	// found next to the importing file
+	SearchPath []string
+
+	modules map[string]*Module
+	loading []string
+}
+
+func NewImports(searchPath ...string) *Imports {
+	return &Imports{SearchPath: searchPath, modules: map[string]*Module{}}
+}
+
+func (i *Imports) Module(path string) (*Module, bool) {
+	module, ok := i.modules[path]
+	return module, ok
+}
+
+// Begin marks path as being loaded. When path is already being loaded it
+// returns false along with the chain of imports leading back to it.
+func (i *Imports) Begin(path string) ([]string, bool) {
+	for n, loading := range i.loading {
+		if loading == path {
+			chain := append([]string{}, i.loading[n:]...)
+			return append(chain, path), false
+		}
+	}
+	i.loading = append(i.loading, path)
+	return nil, true
+}
+
+// End marks the last module passed to Begin as loaded, caching it unless
+// module is nil
+func (i *Imports) End(module *Module) {
+	path := i.loading[len(i.loading)-1]
+	i.loading = i.loading[:len(i.loading)-1]
+	if module != nil {
+		i.modules[path] = module
+	}
+}
+
 type Environment struct {
-	outer *Environment
-	store map[string]Object
+	outer    *Environment
+	store    map[string]Object
+	slots    []Object // locals of a function call, by the slots of the resolver
+	registry *Registry
+	stdio    *Stdio
+	options  *Options
+	imports  *Imports
+	file     string
+	depth    int // calls in progress, for the environment of a call
 }
 
 func NewEnvironment() *Environment {
@@ -25,6 +99,126 @@ func NewEnclousedEnvironment(outer *Environment) *Environment {
 	}
 }
 
+// NewFunctionEnvironment creates the environment of a call to a resolved
+// function, with room for its locals
+func NewFunctionEnvironment(outer *Environment, locals int) *Environment {
+	return &Environment{
+		slots: make([]Object, locals),
+		outer: outer,
+	}
+}
+
+// Depth returns the number of calls in progress in the environment
+func (e *Environment) Depth() int {
+	return e.depth
+}
+
+// SetDepth records the number of calls in progress in the environment of a
+// call
+func (e *Environment) SetDepth(depth int) {
+	e.depth = depth
+}
+
+// NewEnvironmentWithRegistry creates a global environment whose builtins are
+// looked up in registry instead of the interpreter defaults
+func NewEnvironmentWithRegistry(registry *Registry) *Environment {
+	env := NewEnvironment()
+	env.registry = registry
+	return env
+}
+
+// Registry returns the nearest registry attached to this environment or one
+// of its outer environments, nil when there is none
+func (e *Environment) Registry() *Registry {
+	for env := e; env != nil; env = env.outer {
+		if env.registry != nil {
+			return env.registry
+		}
+	}
+	return nil
+}
+
+func (e *Environment) SetRegistry(registry *Registry) {
+	e.registry = registry
+}
+
+// Stdio returns the nearest streams attached to this environment or one of
+// its outer environments, falling back to the process' standard streams
+func (e *Environment) Stdio() *Stdio {
+	for env := e; env != nil; env = env.outer {
+		if env.stdio != nil {
+			return env.stdio
+		}
+	}
+	return defaultStdio
+}
+
+// SetIO redirects the streams used by builtins evaluated in this environment
+func (e *Environment) SetIO(in io.Reader, out io.Writer, err io.Writer) {
+	e.stdio = &Stdio{In: bufio.NewReader(in), Out: out, Err: err}
+}
+
+// Options returns the nearest options attached to this environment or one of
+// its outer environments, falling back to the defaults
+func (e *Environment) Options() *Options {
+	for env := e; env != nil; env = env.outer {
+		if env.options != nil {
+			return env.options
+		}
+	}
+	return defaultOptions
+}
+
+func (e *Environment) SetOptions(options *Options) {
+	e.options = options
+}
+
+// NewModuleEnvironment creates the global environment of the module read
+// from file, sharing the registry, streams, options and imports of env
+func NewModuleEnvironment(env *Environment, file string) *Environment {
+	module := NewEnvironmentWithRegistry(env.Registry())
+	module.stdio = env.Stdio()
+	module.options = env.Options()
+	module.imports = env.Imports()
+	module.file = file
+	return module
+}
+
+// Imports returns the nearest imports attached to this environment or one of
+// its outer environments. When there is none, new imports are attached to the
+// outermost environment so every module is still loaded once.
+func (e *Environment) Imports() *Imports {
+	env := e
+	for ; env.outer != nil; env = env.outer {
+		if env.imports != nil {
+			return env.imports
+		}
+	}
+	if env.imports == nil {
+		env.imports = NewImports()
+	}
+	return env.imports
+}
+
+func (e *Environment) SetImports(imports *Imports) {
+	e.imports = imports
+}
+
+// File returns the path of the file evaluated in this environment or one of
+// its outer environments, empty when the code does not come from a file
+func (e *Environment) File() string {
+	for env := e; env != nil; env = env.outer {
+		if env.file != "" {
+			return env.file
+		}
+	}
+	return ""
+}
+
+func (e *Environment) SetFile(file string) {
+	e.file = file
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -51,6 +245,40 @@ func (e *Environment) Assign(name string, value Object) Object {
 // Set only assigns a value in the current scope, used for let statements
 // let a = 1;
 func (e *Environment) Set(name string, value Object) Object {
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = value
 	return value
 }
+
+// GetAt returns the local in slot of the environment depth calls out from e,
+// false when it was not set yet
+func (e *Environment) GetAt(depth int, slot int) (Object, bool) {
+	obj := e.at(depth).slots[slot]
+	return obj, obj != nil
+}
+
+// SetAt stores a local declared by a let statement
+func (e *Environment) SetAt(slot int, value Object) Object {
+	e.slots[slot] = value
+	return value
+}
+
+// AssignAt changes a local set before, failing like Assign otherwise
+func (e *Environment) AssignAt(depth int, slot int, name string, value Object) Object {
+	env := e.at(depth)
+	if env.slots[slot] == nil {
+		return &Error{Message: fmt.Sprintf("assign to an undefined identifier %s", name)}
+	}
+	env.slots[slot] = value
+	return value
+}
+
+func (e *Environment) at(depth int) *Environment {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	return env
+}
@@ -0,0 +1,163 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// comparison is a pair of containers currently being compared, used to stop
+// the recursion on self-referencing hashes, instances and the arrays they
+// hold
+type comparison struct {
+	left  Object
+	right Object
+}
+
+// Equal reports whether left and right are structurally equal. Arrays are
+// equal when their elements are equal in order, hashes when they hold equal
+// values under the same keys regardless of insertion order and sets when they
+// hold the same elements. Instances are equal when they belong to the same
+// struct and their fields are equal. Functions and
+// builtins are only equal to themselves.
+func Equal(left Object, right Object) bool {
+	return equal(left, right, map[comparison]bool{})
+}
+
+func equal(left Object, right Object, visiting map[comparison]bool) bool {
+	if left == right {
+		return true
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *Integer:
+		return left.Value == right.(*Integer).Value
+	case *Boolean:
+		return left.Value == right.(*Boolean).Value
+	case *String:
+		return left.Value == right.(*String).Value
+	case *Null:
+		return true
+	case *Array:
+		right := right.(*Array)
+		if left.Len() != right.Len() {
+			return false
+		}
+		key := comparison{left, right}
+		if visiting[key] {
+			return true
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+
+		for i := 0; i < left.Len(); i++ {
+			if !equal(left.At(i), right.At(i), visiting) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		right := right.(*Hash)
+		if left.Len() != right.Len() {
+			return false
+		}
+		key := comparison{left, right}
+		if visiting[key] {
+			return true
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+
+		for _, pair := range left.Pairs() {
+			value, ok := right.Get(pair.Key.(Hashable))
+			if !ok || !equal(pair.Value, value, visiting) {
+				return false
+			}
+		}
+		return true
+	case *Instance:
+		right := right.(*Instance)
+		if left.Struct != right.Struct {
+			return false
+		}
+		key := comparison{left, right}
+		if visiting[key] {
+			return true
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+
+		for i, value := range left.Values {
+			if !equal(value, right.Values[i], visiting) {
+				return false
+			}
+		}
+		return true
+	case *Set:
+		right := right.(*Set)
+		if left.Len() != right.Len() {
+			return false
+		}
+		for _, el := range left.Elements() {
+			if !right.Has(el.(Hashable)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// Compare orders left and right, returning a negative number when left sorts
+// before right, zero when they are equal and a positive number otherwise.
+// Integers, strings and booleans compare by value and arrays compare
+// lexicographically. Any other combination is an error.
+//
+// Only arrays nest among comparable values and arrays cannot reference
+// themselves, so unlike Equal there is no need to guard against cycles.
+func Compare(left Object, right Object) (int, error) {
+	if left.Type() != right.Type() {
+		return 0, incomparableError(left, right)
+	}
+
+	switch left := left.(type) {
+	case *Integer:
+		leftVal, rightVal := left.Value, right.(*Integer).Value
+		switch {
+		case leftVal < rightVal:
+			return -1, nil
+		case leftVal > rightVal:
+			return 1, nil
+		}
+		return 0, nil
+	case *String:
+		return strings.Compare(left.Value, right.(*String).Value), nil
+	case *Boolean:
+		leftVal, rightVal := left.Value, right.(*Boolean).Value
+		switch {
+		case leftVal == rightVal:
+			return 0, nil
+		case rightVal:
+			return -1, nil
+		}
+		return 1, nil
+	case *Array:
+		right := right.(*Array)
+		for i := 0; i < left.Len() && i < right.Len(); i++ {
+			result, err := Compare(left.At(i), right.At(i))
+			if err != nil || result != 0 {
+				return result, err
+			}
+		}
+		return Compare(&Integer{Value: int64(left.Len())}, &Integer{Value: int64(right.Len())})
+	default:
+		return 0, incomparableError(left, right)
+	}
+}
+
+func incomparableError(left Object, right Object) error {
+	return fmt.Errorf("unable to compare %s and %s", left.Type(), right.Type())
+}
@@ -0,0 +1,173 @@
+package object
+
+import "math/bits"
+
+const hamtBits = 5
+
+// hamt is a persistent hash array mapped trie from hash keys to values. Each
+// level consumes 5 bits of the key's value and only allocates the children
+// that are present, as told by a bitmap. Like vector, updates return a new
+// trie sharing the untouched nodes with the original.
+//
+// Keys of different types may share a value, so the nodes found once every
+// bit has been consumed simply hold a list of entries.
+type hamt[V any] struct {
+	root *hamtNode[V]
+}
+
+type hamtNode[V any] struct {
+	bitmap  uint32
+	entries []*hamtEntry[V]
+}
+
+// hamtEntry holds either a key and its value or, when node is set, the
+// subtree of the keys sharing the bits consumed so far. Entries are never
+// modified once created, so nodes share them when copied.
+type hamtEntry[V any] struct {
+	key   HashKey
+	value V
+	node  *hamtNode[V]
+}
+
+func newHamt[V any]() *hamt[V] {
+	return &hamt[V]{root: &hamtNode[V]{}}
+}
+
+func (h *hamt[V]) get(key HashKey) (V, bool) {
+	node := h.root
+	for shift := uint(0); ; shift += hamtBits {
+		if shift >= 64 {
+			for _, entry := range node.entries {
+				if entry.key == key {
+					return entry.value, true
+				}
+			}
+			break
+		}
+
+		bit, index := node.position(shift, key)
+		if node.bitmap&bit == 0 {
+			break
+		}
+		entry := node.entries[index]
+		if entry.node != nil {
+			node = entry.node
+			continue
+		}
+		if entry.key == key {
+			return entry.value, true
+		}
+		break
+	}
+
+	var zero V
+	return zero, false
+}
+
+func (h *hamt[V]) set(key HashKey, value V) *hamt[V] {
+	return &hamt[V]{root: h.root.set(0, key, value)}
+}
+
+func (h *hamt[V]) delete(key HashKey) *hamt[V] {
+	root, removed := h.root.delete(0, key)
+	if !removed {
+		return h
+	}
+	return &hamt[V]{root: root}
+}
+
+// position returns the bit of the bitmap standing for key at the given
+// shift, along the index its entry has, or would have, in entries
+func (n *hamtNode[V]) position(shift uint, key HashKey) (uint32, int) {
+	bit := uint32(1) << ((key.Value >> shift) & (1<<hamtBits - 1))
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// set returns a copy of n holding value under key
+func (n *hamtNode[V]) set(shift uint, key HashKey, value V) *hamtNode[V] {
+	if shift >= 64 {
+		for i, entry := range n.entries {
+			if entry.key == key {
+				return n.replace(i, &hamtEntry[V]{key: key, value: value})
+			}
+		}
+		entries := make([]*hamtEntry[V], len(n.entries), len(n.entries)+1)
+		copy(entries, n.entries)
+		return &hamtNode[V]{entries: append(entries, &hamtEntry[V]{key: key, value: value})}
+	}
+
+	bit, index := n.position(shift, key)
+	if n.bitmap&bit == 0 {
+		entries := make([]*hamtEntry[V], 0, len(n.entries)+1)
+		entries = append(entries, n.entries[:index]...)
+		entries = append(entries, &hamtEntry[V]{key: key, value: value})
+		entries = append(entries, n.entries[index:]...)
+		return &hamtNode[V]{bitmap: n.bitmap | bit, entries: entries}
+	}
+
+	entry := n.entries[index]
+	switch {
+	case entry.node != nil:
+		child := entry.node.set(shift+hamtBits, key, value)
+		return n.replace(index, &hamtEntry[V]{node: child})
+	case entry.key == key:
+		return n.replace(index, &hamtEntry[V]{key: key, value: value})
+	default:
+		// two keys share the bits consumed so far, push both one level down
+		child := (&hamtNode[V]{}).set(shift+hamtBits, entry.key, entry.value)
+		child = child.set(shift+hamtBits, key, value)
+		return n.replace(index, &hamtEntry[V]{node: child})
+	}
+}
+
+// delete returns a copy of n without key, and whether the key was present
+func (n *hamtNode[V]) delete(shift uint, key HashKey) (*hamtNode[V], bool) {
+	if shift >= 64 {
+		for i, entry := range n.entries {
+			if entry.key == key {
+				return n.remove(i, 0), true
+			}
+		}
+		return n, false
+	}
+
+	bit, index := n.position(shift, key)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	entry := n.entries[index]
+	if entry.node == nil {
+		if entry.key != key {
+			return n, false
+		}
+		return n.remove(index, bit), true
+	}
+
+	child, removed := entry.node.delete(shift+hamtBits, key)
+	switch {
+	case !removed:
+		return n, false
+	case len(child.entries) == 0:
+		return n.remove(index, bit), true
+	case len(child.entries) == 1 && child.entries[0].node == nil:
+		// a lone key does not need a subtree of its own
+		return n.replace(index, child.entries[0]), true
+	default:
+		return n.replace(index, &hamtEntry[V]{node: child}), true
+	}
+}
+
+func (n *hamtNode[V]) replace(index int, entry *hamtEntry[V]) *hamtNode[V] {
+	entries := make([]*hamtEntry[V], len(n.entries))
+	copy(entries, n.entries)
+	entries[index] = entry
+	return &hamtNode[V]{bitmap: n.bitmap, entries: entries}
+}
+
+func (n *hamtNode[V]) remove(index int, bit uint32) *hamtNode[V] {
+	entries := make([]*hamtEntry[V], 0, len(n.entries)-1)
+	entries = append(entries, n.entries[:index]...)
+	entries = append(entries, n.entries[index+1:]...)
+	return &hamtNode[V]{bitmap: n.bitmap &^ bit, entries: entries}
+}
@@ -7,6 +7,7 @@ import (
 	"monkey/ast"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 type ObjectType string
@@ -17,11 +18,19 @@ const (
 	StringType   ObjectType = "STRING"
 	ArrayType    ObjectType = "ARRAY"
 	HashType     ObjectType = "HASH"
+	SetType      ObjectType = "SET"
 	ReturnType   ObjectType = "RETURN"
 	FunctionType ObjectType = "FUNCTION"
 	BuiltinType  ObjectType = "BUILTIN"
+	StructType   ObjectType = "STRUCT"
+	InstanceType ObjectType = "INSTANCE"
+	MethodType   ObjectType = "METHOD"
+	ModuleType   ObjectType = "MODULE"
 	ErrorType    ObjectType = "ERROR"
 	NullType     ObjectType = "NULL"
+
+	// CompiledFunctionType is only found among the constants of bytecode
+	CompiledFunctionType ObjectType = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -35,6 +44,7 @@ type HashKey struct {
 }
 
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
@@ -64,28 +74,56 @@ func (b *Boolean) HashKey() HashKey {
 	return HashKey{Type: b.Type(), Value: value}
 }
 
+// hashString computes the hash of string keys, tests replace it to force
+// collisions
+var hashString = func(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	return h.Sum64()
+}
+
 type String struct {
 	Value string
+
+	// hash caches the hash of Value, strings are never modified. Constants
+	// are shared by the machines running a program, so it is accessed
+	// atomically, 0 meaning it is not computed yet.
+	hash uint64
 }
 
 func (s *String) Type() ObjectType { return StringType }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
-	key := HashKey{Type: s.Type(), Value: h.Sum64()}
-	return key
+	hash := atomic.LoadUint64(&s.hash)
+	if hash == 0 {
+		hash = hashString(s.Value)
+		atomic.StoreUint64(&s.hash, hash)
+	}
+	return HashKey{Type: s.Type(), Value: hash}
 }
 
+// Array is an immutable list backed by a persistent vector. Operations such
+// as Push and Slice return new arrays sharing most of their structure with
+// the original, so building an array element by element takes linear time.
+//
+// An array is a window over its vector, which lets Slice avoid copying. The
+// zero value is an empty array.
 type Array struct {
-	Elements []Object
+	vec    *vector[Object]
+	offset int
+	length int
+}
+
+// NewArray returns an array holding a copy of elements
+func NewArray(elements []Object) *Array {
+	return &Array{vec: vectorOf(elements), length: len(elements)}
 }
 
 func (a *Array) Type() ObjectType { return ArrayType }
 func (a *Array) Inspect() string {
 	var out strings.Builder
 	list := []string{}
-	for _, el := range a.Elements {
+	for _, el := range a.Elements() {
 		list = append(list, el.Inspect())
 	}
 	out.WriteString("[")
@@ -94,19 +132,74 @@ func (a *Array) Inspect() string {
 	return out.String()
 }
 
+func (a *Array) Len() int {
+	return a.length
+}
+
+// At returns the element at index i, which must be in range
+func (a *Array) At(i int) Object {
+	return a.vec.get(a.offset + i)
+}
+
+// Elements returns a copy of the elements of the array
+func (a *Array) Elements() []Object {
+	if a.length == 0 {
+		return []Object{}
+	}
+	return a.vec.slice(a.offset, a.offset+a.length)
+}
+
+// Push returns a new array with el appended
+func (a *Array) Push(el Object) *Array {
+	end := a.offset + a.length
+	switch {
+	case a.vec == nil:
+		return &Array{vec: newVector[Object]().push(el), length: 1}
+	case end == a.vec.count:
+		return &Array{vec: a.vec.push(el), offset: a.offset, length: a.length + 1}
+	default:
+		// the array is a prefix of its vector, overwrite the next element
+		// instead of copying the window
+		return &Array{vec: a.vec.set(end, el), offset: a.offset, length: a.length + 1}
+	}
+}
+
+// Slice returns the elements in [start, end) without copying them. The
+// bounds must be in range.
+func (a *Array) Slice(start, end int) *Array {
+	if start == end {
+		return &Array{}
+	}
+	return &Array{vec: a.vec, offset: a.offset + start, length: end - start}
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
 }
+
+// Hash maps hashable keys to values, remembering the order in which keys were
+// first inserted. Iteration, Inspect and the hash builtins follow that order.
+//
+// Pairs live in a persistent vector in insertion order and a persistent trie
+// maps each HashKey to their positions. Keys are compared on lookup, so keys
+// whose hashes collide never overwrite each other. Set and Delete replace the
+// structures rather than modifying them, which makes Copy cheap.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs   *vector[HashPair] // deleted pairs leave a nil Key behind
+	buckets *hamt[[]int]
+	length  int
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: newVector[HashPair](), buckets: newHamt[[]int]()}
 }
 
 func (hm *Hash) Type() ObjectType { return HashType }
 func (hm *Hash) Inspect() string {
 	var out strings.Builder
 	pairs := []string{}
-	for _, pair := range hm.Pairs {
+	for _, pair := range hm.Pairs() {
 		pairs = append(pairs, pair.Key.Inspect()+":"+pair.Value.Inspect())
 	}
 	out.WriteString("{")
@@ -115,6 +208,180 @@ func (hm *Hash) Inspect() string {
 	return out.String()
 }
 
+// find returns the position of key in pairs, or -1
+func (hm *Hash) find(key Hashable, hashed HashKey) int {
+	if hm.buckets == nil {
+		return -1
+	}
+	positions, _ := hm.buckets.get(hashed)
+	for _, i := range positions {
+		if Equal(hm.pairs.get(i).Key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (hm *Hash) Get(key Hashable) (Object, bool) {
+	i := hm.find(key, key.HashKey())
+	if i < 0 {
+		return nil, false
+	}
+	return hm.pairs.get(i).Value, true
+}
+
+// Set stores value under key. Keys already present keep their position.
+func (hm *Hash) Set(key Hashable, value Object) {
+	if hm.buckets == nil {
+		*hm = *NewHash()
+	}
+	hashed := key.HashKey()
+	if i := hm.find(key, hashed); i >= 0 {
+		hm.pairs = hm.pairs.set(i, HashPair{Key: hm.pairs.get(i).Key, Value: value})
+		return
+	}
+
+	positions, _ := hm.buckets.get(hashed)
+	positions = append(positions[:len(positions):len(positions)], hm.pairs.count)
+	hm.buckets = hm.buckets.set(hashed, positions)
+	hm.pairs = hm.pairs.push(HashPair{Key: key, Value: value})
+	hm.length++
+}
+
+func (hm *Hash) Delete(key Hashable) {
+	hashed := key.HashKey()
+	i := hm.find(key, hashed)
+	if i < 0 {
+		return
+	}
+	hm.pairs = hm.pairs.set(i, HashPair{})
+	hm.length--
+
+	positions, _ := hm.buckets.get(hashed)
+	remaining := []int{}
+	for _, position := range positions {
+		if position != i {
+			remaining = append(remaining, position)
+		}
+	}
+	if len(remaining) == 0 {
+		hm.buckets = hm.buckets.delete(hashed)
+	} else {
+		hm.buckets = hm.buckets.set(hashed, remaining)
+	}
+
+	// drop the holes once they outnumber the pairs
+	if hm.pairs.count > vectorWidth && hm.Len() < hm.pairs.count/2 {
+		*hm = *hm.compact()
+	}
+}
+
+// compact returns a hash holding the same pairs without deleted ones
+func (hm *Hash) compact() *Hash {
+	compacted := NewHash()
+	for _, pair := range hm.Pairs() {
+		compacted.Set(pair.Key.(Hashable), pair.Value)
+	}
+	return compacted
+}
+
+func (hm *Hash) Len() int {
+	return hm.length
+}
+
+// Pairs returns the pairs of the hash in insertion order
+func (hm *Hash) Pairs() []HashPair {
+	if hm.pairs == nil {
+		return []HashPair{}
+	}
+	pairs := make([]HashPair, 0, hm.length)
+	for _, pair := range hm.pairs.slice(0, hm.pairs.count) {
+		if pair.Key != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// Copy returns a new hash holding the same pairs. The copy shares its
+// structure with hm, so it is made in constant time.
+func (hm *Hash) Copy() *Hash {
+	copied := *hm
+	return &copied
+}
+
+// Set is an unordered collection of distinct hashable elements. It is backed
+// by a Hash whose keys are the elements, so it shares its collision handling
+// and remembers the order in which elements were first added.
+type Set struct {
+	elements *Hash
+}
+
+func NewSet() *Set {
+	return &Set{elements: NewHash()}
+}
+
+func (s *Set) Type() ObjectType { return SetType }
+func (s *Set) Inspect() string {
+	var out strings.Builder
+	elements := []string{}
+	for _, el := range s.Elements() {
+		elements = append(elements, el.Inspect())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (s *Set) Add(el Hashable) {
+	if s.elements == nil {
+		s.elements = NewHash()
+	}
+	s.elements.Set(el, el)
+}
+
+func (s *Set) Has(el Hashable) bool {
+	if s.elements == nil {
+		return false
+	}
+	_, ok := s.elements.Get(el)
+	return ok
+}
+
+func (s *Set) Remove(el Hashable) {
+	if s.elements != nil {
+		s.elements.Delete(el)
+	}
+}
+
+func (s *Set) Len() int {
+	if s.elements == nil {
+		return 0
+	}
+	return s.elements.Len()
+}
+
+// Elements returns the elements of the set in insertion order
+func (s *Set) Elements() []Object {
+	if s.elements == nil {
+		return []Object{}
+	}
+	elements := make([]Object, 0, s.elements.Len())
+	for _, pair := range s.elements.Pairs() {
+		elements = append(elements, pair.Key)
+	}
+	return elements
+}
+
+// Copy returns a new set holding the same elements
+func (s *Set) Copy() *Set {
+	if s.elements == nil {
+		return NewSet()
+	}
+	return &Set{elements: s.elements.Copy()}
+}
+
 type ReturnValue struct {
 	Value Object
 }
@@ -126,6 +393,7 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Locals     []string // names of the locals by slot, nil when unresolved
 }
 
 func (f *Function) Type() ObjectType { return FunctionType }
@@ -147,15 +415,94 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
-type BuiltinFunction func(args ...Object) Object
+// Callable is implemented by functions that run outside of the evaluator,
+// such as the closures of the virtual machine, so builtins taking functions
+// can still call them
+type Callable interface {
+	Object
+	Call(env *Environment, args []Object) Object
+}
+
+// Struct is a record type declared with the struct keyword. Calling it
+// creates an instance, taking the values of the fields in declaration order.
+type Struct struct {
+	Name    string
+	Fields  []string
+	Methods map[string]Object // *Function, or the closures of the virtual machine
+}
+
+func (s *Struct) Type() ObjectType { return StructType }
+func (s *Struct) Inspect() string  { return "struct " + s.Name }
+
+// Instance is a value of a struct. Its fields are fixed by the struct and
+// hold their values in the same order.
+type Instance struct {
+	Struct *Struct
+	Values []Object
+}
+
+func (i *Instance) Type() ObjectType { return InstanceType }
+func (i *Instance) Inspect() string {
+	var out strings.Builder
+	fields := []string{}
+	for j, name := range i.Struct.Fields {
+		fields = append(fields, name+": "+i.Values[j].Inspect())
+	}
+	out.WriteString(i.Struct.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// Field returns the value of the named field
+func (i *Instance) Field(name string) (Object, bool) {
+	for j, field := range i.Struct.Fields {
+		if field == name {
+			return i.Values[j], true
+		}
+	}
+	return nil, false
+}
+
+// BoundMethod is a method together with the receiver it was looked up on.
+// Methods of structs see the receiver as self, builtins used as methods
+// receive it as their first argument.
+type BoundMethod struct {
+	Receiver Object
+	Method   Object // *Function, *Builtin or a Callable
+	Name     string
+}
+
+func (bm *BoundMethod) Type() ObjectType { return MethodType }
+func (bm *BoundMethod) Inspect() string {
+	if instance, ok := bm.Receiver.(*Instance); ok {
+		return "method " + instance.Struct.Name + "." + bm.Name
+	}
+	return "method " + string(bm.Receiver.Type()) + "." + bm.Name
+}
+
+// BuiltinFunction receives the environment of the caller, which gives access
+// to the interpreter's registry and standard streams
+type BuiltinFunction func(env *Environment, args ...Object) Object
 
 type Builtin struct {
-	Fn BuiltinFunction
+	Name string
+	Fn   BuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BuiltinType }
 func (b *Builtin) Inspect() string  { return "builting function" }
 
+// Module groups named members reachable through the dot operator
+type Module struct {
+	Name    string
+	Members map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return ModuleType }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
 type Error struct {
 	Message string
 }
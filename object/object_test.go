@@ -1,8 +1,12 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
 
-func TestStringHashKey(t testing.T) {
+func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
 	hello2 := &String{Value: "Hello World"}
 	diff1 := &String{Value: "My name is johnny"}
@@ -18,3 +22,399 @@ func TestStringHashKey(t testing.T) {
 		t.Errorf("strings with the different content have the same hash keys")
 	}
 }
+
+func TestStringHashKeyConcurrently(t *testing.T) {
+	shared := &String{Value: "shared"}
+	expected := (&String{Value: "shared"}).HashKey()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if shared.HashKey() != expected {
+				t.Errorf("wrong hash key for a string shared between goroutines")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRegistryNamespaces(t *testing.T) {
+	registry := NewRegistry()
+	noop := func(env *Environment, args ...Object) Object { return nil }
+	registry.Register("len", noop)
+	registry.Register("strings.upper", noop)
+	registry.Register("strings.lower", noop)
+
+	module, ok := registry.Lookup("strings")
+	if !ok {
+		t.Fatalf("namespace strings was not registered")
+	}
+	if _, ok := registry.Lookup("strings.upper"); !ok {
+		t.Errorf("strings.upper was not registered")
+	}
+
+	registry.Unregister("strings.upper")
+	if _, ok := registry.Lookup("strings.upper"); ok {
+		t.Errorf("strings.upper was not unregistered")
+	}
+	if _, ok := module.(*Module).Members["upper"]; !ok {
+		t.Errorf("unregister modified a module already handed out")
+	}
+
+	names := registry.Names()
+	expected := []string{"len", "strings.lower"}
+	if len(names) != len(expected) {
+		t.Fatalf("wrong names, got=%v, want=%v", names, expected)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("wrong name at %d, got=%q, want=%q", i, names[i], name)
+		}
+	}
+
+	restricted := registry.Restrict("strings")
+	if _, ok := restricted.Lookup("len"); ok {
+		t.Errorf("restricted registry kept len")
+	}
+	if _, ok := restricted.Lookup("strings.lower"); !ok {
+		t.Errorf("restricted registry dropped strings.lower")
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 1}, &Integer{Value: 2})
+	hash.Set(&String{Value: "a"}, &Integer{Value: 3})
+	hash.Set(&String{Value: "b"}, &Integer{Value: 4})
+
+	if hash.Inspect() != "{b:4, 1:2, a:3}" {
+		t.Errorf("hash.Inspect() wrong, got=%q", hash.Inspect())
+	}
+
+	pairs := hash.Pairs()
+	hash.Delete(&Integer{Value: 1})
+	if hash.Inspect() != "{b:4, a:3}" {
+		t.Errorf("hash.Inspect() wrong after delete, got=%q", hash.Inspect())
+	}
+	if len(pairs) != 3 || pairs[1].Key.Inspect() != "1" {
+		t.Errorf("delete modified previously returned pairs")
+	}
+
+	value, ok := hash.Get(&String{Value: "a"})
+	if !ok || value.Inspect() != "3" {
+		t.Errorf("wrong value for key a, got=%v", value)
+	}
+	if _, ok := hash.Get(&Integer{Value: 1}); ok {
+		t.Errorf("deleted key is still present")
+	}
+}
+
+func TestSet(t *testing.T) {
+	set := NewSet()
+	set.Add(&Integer{Value: 3})
+	set.Add(&String{Value: "a"})
+	set.Add(&Integer{Value: 1})
+	set.Add(&Integer{Value: 3})
+
+	if set.Len() != 3 {
+		t.Errorf("set has wrong length, got=%d", set.Len())
+	}
+	if set.Inspect() != "#{3, a, 1}" {
+		t.Errorf("set.Inspect() wrong, got=%q", set.Inspect())
+	}
+
+	copied := set.Copy()
+	set.Remove(&Integer{Value: 3})
+	if set.Has(&Integer{Value: 3}) || !set.Has(&Integer{Value: 1}) {
+		t.Errorf("wrong elements after remove, got=%s", set.Inspect())
+	}
+	if copied.Inspect() != "#{3, a, 1}" {
+		t.Errorf("remove modified the copy, got=%q", copied.Inspect())
+	}
+
+	var empty Set
+	if empty.Len() != 0 || empty.Has(&Integer{Value: 1}) || empty.Inspect() != "#{}" {
+		t.Errorf("zero value set is not empty")
+	}
+}
+
+func TestArrayPersistence(t *testing.T) {
+	// enough elements to need a trie three levels deep
+	const size = 40000
+
+	arrays := []*Array{{}}
+	for i := 0; i < size; i++ {
+		arrays = append(arrays, arrays[i].Push(&Integer{Value: int64(i)}))
+	}
+	for _, n := range []int{0, 1, 31, 32, 33, 1024, 1025, size} {
+		arr := arrays[n]
+		if arr.Len() != n {
+			t.Fatalf("array %d has wrong length, got=%d", n, arr.Len())
+		}
+		for i, el := range arr.Elements() {
+			if el.(*Integer).Value != int64(i) || arr.At(i) != el {
+				t.Fatalf("array %d has wrong element at %d, got=%s", n, i, el.Inspect())
+			}
+		}
+	}
+
+	built := NewArray(arrays[size].Elements())
+	if !Equal(built, arrays[size]) {
+		t.Errorf("NewArray and Push disagree")
+	}
+
+	slice := arrays[100].Slice(10, 20)
+	pushed := slice.Push(&String{Value: "x"})
+	if slice.Len() != 10 || slice.At(0).Inspect() != "10" {
+		t.Errorf("wrong slice, got=%s", slice.Inspect())
+	}
+	if pushed.Len() != 11 || pushed.At(10).Inspect() != "x" {
+		t.Errorf("wrong push on slice, got=%s", pushed.Inspect())
+	}
+	if arrays[100].At(20).Inspect() != "20" {
+		t.Errorf("pushing on a slice modified the original, got=%s", arrays[100].At(20).Inspect())
+	}
+}
+
+func TestHashPersistence(t *testing.T) {
+	const size = 5000
+
+	hash := NewHash()
+	for i := 0; i < size; i++ {
+		hash.Set(&Integer{Value: int64(i)}, &Integer{Value: int64(i * 2)})
+	}
+	copied := hash.Copy()
+	for i := 0; i < size; i += 2 {
+		hash.Delete(&Integer{Value: int64(i)})
+	}
+	hash.Set(&Integer{Value: 1}, &String{Value: "one"})
+
+	if hash.Len() != size/2 || copied.Len() != size {
+		t.Fatalf("wrong lengths, got=%d and %d", hash.Len(), copied.Len())
+	}
+	for i, pair := range hash.Pairs() {
+		if pair.Key.(*Integer).Value != int64(i*2+1) {
+			t.Fatalf("wrong key at %d, got=%s", i, pair.Key.Inspect())
+		}
+	}
+	if value, _ := hash.Get(&Integer{Value: 1}); value.Inspect() != "one" {
+		t.Errorf("wrong value for 1, got=%s", value.Inspect())
+	}
+	if value, _ := copied.Get(&Integer{Value: 1}); value.Inspect() != "2" {
+		t.Errorf("updating a hash modified its copy, got=%s", value.Inspect())
+	}
+	if value, ok := copied.Get(&Integer{Value: 4}); !ok || value.Inspect() != "8" {
+		t.Errorf("deleting from a hash modified its copy")
+	}
+}
+
+func TestHashKeyCollisions(t *testing.T) {
+	original := hashString
+	hashString = func(string) uint64 { return 42 }
+	defer func() { hashString = original }()
+
+	first := &String{Value: "first"}
+	second := &String{Value: "second"}
+	if first.HashKey() != second.HashKey() {
+		t.Fatalf("expected colliding hash keys")
+	}
+
+	hash := NewHash()
+	hash.Set(first, &Integer{Value: 1})
+	hash.Set(second, &Integer{Value: 2})
+	hash.Set(&String{Value: "first"}, &Integer{Value: 3})
+
+	if hash.Len() != 2 {
+		t.Fatalf("colliding keys overwrote each other, got=%s", hash.Inspect())
+	}
+	if value, _ := hash.Get(&String{Value: "first"}); value.Inspect() != "3" {
+		t.Errorf("wrong value for first, got=%v", value)
+	}
+	if value, _ := hash.Get(&String{Value: "second"}); value.Inspect() != "2" {
+		t.Errorf("wrong value for second, got=%v", value)
+	}
+	if _, ok := hash.Get(&String{Value: "third"}); ok {
+		t.Errorf("lookup of a missing colliding key succeeded")
+	}
+
+	hash.Delete(&String{Value: "first"})
+	if value, _ := hash.Get(&String{Value: "second"}); hash.Len() != 1 || value.Inspect() != "2" {
+		t.Errorf("delete removed the wrong key, got=%s", hash.Inspect())
+	}
+
+	// keys of different types whose hash keys share every bit of their value
+	hash.Set(&Integer{Value: 42}, &Integer{Value: 4})
+	hash.Set(&Integer{Value: 1}, &Integer{Value: 5})
+	hash.Set(&Boolean{Value: true}, &Integer{Value: 6})
+	if value, _ := hash.Get(&Integer{Value: 42}); value.Inspect() != "4" {
+		t.Errorf("wrong value for 42, got=%v", value)
+	}
+	if value, _ := hash.Get(&Boolean{Value: true}); value.Inspect() != "6" {
+		t.Errorf("wrong value for true, got=%v", value)
+	}
+	hash.Delete(&Integer{Value: 1})
+	if value, _ := hash.Get(&Boolean{Value: true}); hash.Len() != 3 || value.Inspect() != "6" {
+		t.Errorf("delete removed the wrong key, got=%s", hash.Inspect())
+	}
+}
+
+func TestStringHashKeyIsCached(t *testing.T) {
+	calls := 0
+	original := hashString
+	hashString = func(value string) uint64 {
+		calls++
+		return original(value)
+	}
+	defer func() { hashString = original }()
+
+	str := &String{Value: "a rather long key"}
+	for i := 0; i < 3; i++ {
+		str.HashKey()
+	}
+	if calls != 1 {
+		t.Errorf("string was hashed %d times, want=1", calls)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	one := &Integer{Value: 1}
+	hash := NewHash()
+	hash.Set(&String{Value: "a"}, NewArray([]Object{one}))
+	sameHash := NewHash()
+	sameHash.Set(&String{Value: "a"}, NewArray([]Object{&Integer{Value: 1}}))
+
+	tests := []struct {
+		left     Object
+		right    Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, &String{Value: "1"}, false},
+		{&Null{}, &Null{}, true},
+		{NewArray([]Object{one}), NewArray([]Object{&Integer{Value: 1}}), true},
+		{NewArray([]Object{one}), NewArray([]Object{}), false},
+		{hash, sameHash, true},
+		{hash, NewHash(), false},
+		{set(one, &String{Value: "a"}), set(&String{Value: "a"}, one), true},
+		{set(one), set(&Integer{Value: 2}), false},
+		{set(one), set(one, &Integer{Value: 2}), false},
+		{NewSet(), NewHash(), false},
+	}
+
+	for _, tt := range tests {
+		if Equal(tt.left, tt.right) != tt.expected {
+			t.Errorf("Equal(%s, %s) is not %t", tt.left.Inspect(), tt.right.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestEqualSelfReferencing(t *testing.T) {
+	// arrays are immutable, so they can only reach themselves through a hash
+	left := NewHash()
+	left.Set(&String{Value: "items"}, NewArray([]Object{&Integer{Value: 1}, left}))
+	right := NewHash()
+	right.Set(&String{Value: "items"}, NewArray([]Object{&Integer{Value: 1}, right}))
+
+	if !Equal(left, right) {
+		t.Errorf("self referencing arrays with the same shape are not equal")
+	}
+
+	leftHash := NewHash()
+	leftHash.Set(&String{Value: "self"}, leftHash)
+	rightHash := NewHash()
+	rightHash.Set(&String{Value: "self"}, rightHash)
+	if !Equal(leftHash, rightHash) {
+		t.Errorf("self referencing hashes with the same shape are not equal")
+	}
+
+	node := &Struct{Name: "Node", Fields: []string{"next"}}
+	leftNode := &Instance{Struct: node, Values: []Object{nil}}
+	leftNode.Values[0] = leftNode
+	rightNode := &Instance{Struct: node, Values: []Object{nil}}
+	rightNode.Values[0] = rightNode
+	if !Equal(leftNode, rightNode) {
+		t.Errorf("self referencing instances with the same shape are not equal")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	array := func(values ...int64) *Array {
+		elements := []Object{}
+		for _, value := range values {
+			elements = append(elements, &Integer{Value: value})
+		}
+		return NewArray(elements)
+	}
+
+	tests := []struct {
+		left     Object
+		right    Object
+		expected int
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1},
+		{&String{Value: "b"}, &String{Value: "a"}, 1},
+		{&Boolean{Value: false}, &Boolean{Value: true}, -1},
+		{array(1, 2), array(1, 2), 0},
+		{array(1, 2), array(1, 3), -1},
+		{array(1, 2, 3), array(1, 2), 1},
+		{array(), array(0), -1},
+	}
+
+	for _, tt := range tests {
+		result, err := Compare(tt.left, tt.right)
+		if err != nil {
+			t.Errorf("unexpected error comparing %s and %s: %s", tt.left.Inspect(), tt.right.Inspect(), err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("Compare(%s, %s) wrong, got=%d, want=%d", tt.left.Inspect(), tt.right.Inspect(), result, tt.expected)
+		}
+	}
+
+	_, err := Compare(&Integer{Value: 1}, &String{Value: "1"})
+	if err == nil || err.Error() != "unable to compare INTEGER and STRING" {
+		t.Errorf("wrong error comparing different types, got=%v", err)
+	}
+}
+
+func set(elements ...Hashable) *Set {
+	s := NewSet()
+	for _, el := range elements {
+		s.Add(el)
+	}
+	return s
+}
+
+// BenchmarkArrayPush builds arrays one push at a time, each push keeping the
+// previous array intact
+func BenchmarkArrayPush(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				arr := NewArray(nil)
+				for j := 0; j < n; j++ {
+					arr = arr.Push(&Integer{Value: int64(j)})
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkHashSet builds hashes one key at a time, each key added to a copy
+// so the previous hash stays intact
+func BenchmarkHashSet(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hash := NewHash()
+				for j := 0; j < n; j++ {
+					hash = hash.Copy()
+					hash.Set(&Integer{Value: int64(j)}, &Integer{Value: int64(j)})
+				}
+			}
+		})
+	}
+}
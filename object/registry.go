@@ -0,0 +1,146 @@
+package object
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry holds the builtin functions visible to an interpreter.
+//
+// Names containing a dot, such as "strings.upper", are grouped into a Module
+// named after the part before the dot, so scripts reach them through the dot
+// operator. A Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[string]Object
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]Object)}
+}
+
+// Register adds fn under name, replacing any previous entry with that name
+func (r *Registry) Register(name string, fn BuiltinFunction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.register(name, &Builtin{Name: name, Fn: fn})
+}
+
+func (r *Registry) register(name string, builtin *Builtin) {
+	namespace, member, found := strings.Cut(name, ".")
+	if !found {
+		r.entries[name] = builtin
+		return
+	}
+
+	// Modules are copied on write so a Module already handed out to a script
+	// never changes underneath it
+	module := &Module{Name: namespace, Members: make(map[string]Object)}
+	if existing, ok := r.entries[namespace].(*Module); ok {
+		for key, value := range existing.Members {
+			module.Members[key] = value
+		}
+	}
+	module.Members[member] = builtin
+	r.entries[namespace] = module
+}
+
+// Unregister removes name from the registry. Removing a namespace removes
+// every builtin inside of it.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	namespace, member, found := strings.Cut(name, ".")
+	if !found {
+		delete(r.entries, name)
+		return
+	}
+
+	existing, ok := r.entries[namespace].(*Module)
+	if !ok {
+		return
+	}
+	module := &Module{Name: namespace, Members: make(map[string]Object)}
+	for key, value := range existing.Members {
+		if key != member {
+			module.Members[key] = value
+		}
+	}
+	if len(module.Members) == 0 {
+		delete(r.entries, namespace)
+		return
+	}
+	r.entries[namespace] = module
+}
+
+// Lookup returns the builtin or module registered under name
+func (r *Registry) Lookup(name string) (Object, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	namespace, member, found := strings.Cut(name, ".")
+	if !found {
+		obj, ok := r.entries[name]
+		return obj, ok
+	}
+
+	module, ok := r.entries[namespace].(*Module)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := module.Members[member]
+	return obj, ok
+}
+
+// Names returns the fully qualified name of every registered builtin, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := []string{}
+	for name, entry := range r.entries {
+		module, ok := entry.(*Module)
+		if !ok {
+			names = append(names, name)
+			continue
+		}
+		for member := range module.Members {
+			names = append(names, name+"."+member)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns an independent copy of the registry
+func (r *Registry) Clone() *Registry {
+	return r.Restrict(r.Names()...)
+}
+
+// Restrict returns a new registry holding only the given names, which is
+// useful to build sandboxes. A bare namespace such as "strings" keeps every
+// builtin inside of it. Unknown names are ignored.
+func (r *Registry) Restrict(names ...string) *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	restricted := NewRegistry()
+	for _, name := range names {
+		namespace, member, found := strings.Cut(name, ".")
+		switch entry := r.entries[namespace].(type) {
+		case *Builtin:
+			if !found {
+				restricted.register(name, entry)
+			}
+		case *Module:
+			for key, value := range entry.Members {
+				if builtin, ok := value.(*Builtin); ok && (!found || key == member) {
+					restricted.register(namespace+"."+key, builtin)
+				}
+			}
+		}
+	}
+	return restricted
+}
@@ -0,0 +1,163 @@
+package object
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// vector is a persistent vector: a trie with a branching factor of 32 holding
+// every element but the last few, which are kept in a tail buffer. Updates
+// never modify a vector, they return a new one sharing every untouched node
+// with the original, so appending and replacing elements cost O(log32 n).
+type vector[T any] struct {
+	count int
+	shift uint
+	root  *vectorNode[T]
+	tail  []T
+}
+
+// vectorNode is an inner node of the trie when children is set, or a leaf
+// holding up to 32 values otherwise
+type vectorNode[T any] struct {
+	children []*vectorNode[T]
+	values   []T
+}
+
+func newVector[T any]() *vector[T] {
+	return &vector[T]{shift: vectorBits, root: &vectorNode[T]{}}
+}
+
+// vectorOf builds a vector holding values, which are copied
+func vectorOf[T any](values []T) *vector[T] {
+	v := newVector[T]()
+	for len(values) > 0 {
+		n := min(vectorWidth, len(values))
+		v = v.pushLeaf(values[:n:n])
+		values = values[n:]
+	}
+	return v
+}
+
+func (v *vector[T]) tailOffset() int {
+	if v.count < vectorWidth {
+		return 0
+	}
+	return ((v.count - 1) >> vectorBits) << vectorBits
+}
+
+// leaf returns the leaf, or the tail, holding the element at index i. Leaves
+// always start at a multiple of 32, so the element is at i&vectorMask.
+func (v *vector[T]) leaf(i int) []T {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values
+}
+
+func (v *vector[T]) get(i int) T {
+	return v.leaf(i)[i&vectorMask]
+}
+
+// slice copies the elements in [start, end) into a new slice
+func (v *vector[T]) slice(start, end int) []T {
+	result := make([]T, 0, end-start)
+	for i := start; i < end; {
+		leaf := v.leaf(i)
+		j := i & vectorMask
+		n := min(len(leaf)-j, end-i)
+		result = append(result, leaf[j:j+n]...)
+		i += n
+	}
+	return result
+}
+
+func (v *vector[T]) push(value T) *vector[T] {
+	if len(v.tail) < vectorWidth {
+		tail := make([]T, len(v.tail)+1)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = value
+		return &vector[T]{count: v.count + 1, shift: v.shift, root: v.root, tail: tail}
+	}
+	return v.pushLeaf([]T{value})
+}
+
+// pushLeaf moves the current tail, which must be either empty or full, into
+// the trie and makes a copy of values, holding at most 32 elements, the new
+// tail
+func (v *vector[T]) pushLeaf(values []T) *vector[T] {
+	tail := make([]T, len(values))
+	copy(tail, values)
+	if len(v.tail) == 0 {
+		return &vector[T]{count: v.count + len(tail), shift: v.shift, root: v.root, tail: tail}
+	}
+
+	leaf := &vectorNode[T]{values: v.tail}
+	shift := v.shift
+	var root *vectorNode[T]
+	if (v.count >> vectorBits) > (1 << v.shift) {
+		// the trie is full, grow it by one level
+		root = &vectorNode[T]{children: []*vectorNode[T]{v.root, newVectorPath(v.shift, leaf)}}
+		shift += vectorBits
+	} else {
+		root = v.pushTail(v.shift, v.root, leaf)
+	}
+	return &vector[T]{count: v.count + len(tail), shift: shift, root: root, tail: tail}
+}
+
+// pushTail returns a copy of parent with leaf appended at the position of the
+// last element currently in the tail
+func (v *vector[T]) pushTail(level uint, parent *vectorNode[T], leaf *vectorNode[T]) *vectorNode[T] {
+	index := ((v.count - 1) >> level) & vectorMask
+	children := make([]*vectorNode[T], max(len(parent.children), index+1))
+	copy(children, parent.children)
+
+	switch {
+	case level == vectorBits:
+		children[index] = leaf
+	case index < len(parent.children):
+		children[index] = v.pushTail(level-vectorBits, parent.children[index], leaf)
+	default:
+		children[index] = newVectorPath(level-vectorBits, leaf)
+	}
+	return &vectorNode[T]{children: children}
+}
+
+func newVectorPath[T any](level uint, leaf *vectorNode[T]) *vectorNode[T] {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode[T]{children: []*vectorNode[T]{newVectorPath(level-vectorBits, leaf)}}
+}
+
+// set returns a vector where the element at index i, which must be lower
+// than count, is replaced by value
+func (v *vector[T]) set(i int, value T) *vector[T] {
+	if i >= v.tailOffset() {
+		tail := make([]T, len(v.tail))
+		copy(tail, v.tail)
+		tail[i&vectorMask] = value
+		return &vector[T]{count: v.count, shift: v.shift, root: v.root, tail: tail}
+	}
+	root := setVectorNode(v.shift, v.root, i, value)
+	return &vector[T]{count: v.count, shift: v.shift, root: root, tail: v.tail}
+}
+
+func setVectorNode[T any](level uint, node *vectorNode[T], i int, value T) *vectorNode[T] {
+	if level == 0 {
+		values := make([]T, len(node.values))
+		copy(values, node.values)
+		values[i&vectorMask] = value
+		return &vectorNode[T]{values: values}
+	}
+
+	children := make([]*vectorNode[T], len(node.children))
+	copy(children, node.children)
+	index := (i >> level) & vectorMask
+	children[index] = setVectorNode(level-vectorBits, children[index], i, value)
+	return &vectorNode[T]{children: children}
+}
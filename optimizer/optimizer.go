@@ -0,0 +1,386 @@
+// Package optimizer rewrites a program into an equivalent one doing less work
+// when it runs. It folds operators applied to literals, drops the branches of
+// conditions known in advance and inlines the literals bound by let
+// statements to variables never changed afterwards.
+//
+// The optimizer tells variables apart by the bindings of the resolver, so it
+// expects a program the resolver checked without errors.
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+// variable identifies a global by its name or a local by the function
+// declaring it and its slot
+type variable struct {
+	fn   *ast.FunctionLiteral
+	slot int
+	name string
+}
+
+type optimizer struct {
+	// functions holds the functions being rewritten, the innermost last
+	functions []*ast.FunctionLiteral
+
+	// declarations counts the statements declaring or changing a variable,
+	// literals holds the values of the variables bound to a literal
+	declarations map[variable]int
+	literals     map[variable]ast.Expression
+
+	// bound holds the variables whose let the rewriting went past. Code
+	// before the let, such as a function called early, finds no value and
+	// is left to fail as it would.
+	bound map[variable]bool
+
+	changed bool
+}
+
+// Optimize rewrites program in place and returns it
+func Optimize(program *ast.Program) *ast.Program {
+	for {
+		o := &optimizer{
+			declarations: map[variable]int{},
+			literals:     map[variable]ast.Expression{},
+			bound:        map[variable]bool{},
+		}
+		o.collectStatements(program.Statements, true)
+		program.Statements = o.statements(program.Statements)
+		if !o.changed {
+			return program
+		}
+	}
+}
+
+// collectStatements finds the variables bound to a literal and never changed.
+// Only the lets run by every call of a function, at the top of its body, bind
+// a literal for sure.
+func (o *optimizer) collectStatements(statements []ast.Statement, top bool) {
+	for _, s := range statements {
+		o.collectStatement(s, top)
+	}
+}
+
+func (o *optimizer) collectStatement(node ast.Statement, top bool) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		v := o.variable(node.Name)
+		o.declarations[v]++
+		if top && isLiteral(node.Value) {
+			o.literals[v] = node.Value
+		}
+		o.collectExpression(node.Value)
+	case *ast.AssignmentStatement:
+		o.declarations[o.variable(node.Name)]++
+		o.collectExpression(node.Value)
+	case *ast.StructStatement:
+		o.declarations[o.variable(node.Name)]++
+		for _, method := range node.Methods {
+			o.collectFunction(method.Function, true)
+		}
+	case *ast.ImportStatement:
+		o.declarations[o.variable(node.Alias)]++
+	case *ast.ExportStatement:
+		o.collectStatement(node.Statement, top)
+	case *ast.ReturnStatement:
+		o.collectExpression(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		o.collectExpression(node.Expression)
+	case *ast.BlockStatement:
+		o.collectStatements(node.Statements, false)
+	}
+}
+
+func (o *optimizer) collectExpression(node ast.Expression) {
+	switch node := node.(type) {
+	case *ast.FunctionLiteral:
+		o.collectFunction(node, false)
+	case *ast.IfExpression:
+		o.collectExpression(node.Condition)
+		o.collectBlock(node.Consequence)
+		o.collectBlock(node.Alternative)
+	case *ast.PrefixExpression:
+		o.collectExpression(node.Right)
+	case *ast.InfixExpression:
+		o.collectExpression(node.Left)
+		o.collectExpression(node.Right)
+	case *ast.PostfixExpression:
+		o.collectExpression(node.Left)
+	case *ast.CallExpression:
+		o.collectExpression(node.Function)
+		o.collectExpressions(node.Arguments)
+	case *ast.ArrayLiteral:
+		o.collectExpressions(node.Elements)
+	case *ast.SetLiteral:
+		o.collectExpressions(node.Elements)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			o.collectExpression(pair.Key)
+			o.collectExpression(pair.Value)
+		}
+	case *ast.IndexExpression:
+		o.collectExpression(node.Left)
+		o.collectExpression(node.Index)
+	case *ast.SliceExpression:
+		o.collectExpressions([]ast.Expression{node.Left, node.Start, node.End, node.Step})
+	case *ast.DotExpression:
+		o.collectExpression(node.Left)
+	}
+}
+
+func (o *optimizer) collectExpressions(expressions []ast.Expression) {
+	for _, exp := range expressions {
+		o.collectExpression(exp)
+	}
+}
+
+func (o *optimizer) collectBlock(block *ast.BlockStatement) {
+	if block != nil {
+		o.collectStatements(block.Statements, false)
+	}
+}
+
+// collectFunction counts the slots set by calls, self and the parameters,
+// as declarations so they are never inlined
+func (o *optimizer) collectFunction(fn *ast.FunctionLiteral, method bool) {
+	o.functions = append(o.functions, fn)
+	set := len(fn.Parameters)
+	if method {
+		set++
+	}
+	for slot := 0; slot < set; slot++ {
+		o.declarations[variable{fn: fn, slot: slot}]++
+	}
+	o.collectStatements(fn.Body.Statements, true)
+	o.functions = o.functions[:len(o.functions)-1]
+}
+
+// statements rewrites a list of statements, replacing the conditions known
+// in advance by the statements of the branch taken
+func (o *optimizer) statements(statements []ast.Statement) []ast.Statement {
+	out := make([]ast.Statement, 0, len(statements))
+	for i, s := range statements {
+		s = o.statement(s)
+
+		last := i == len(statements)-1
+		if branch, ok := o.liveBranch(s); ok {
+			// the last statement gives its value to the list, which an empty
+			// branch does not have
+			if branch != nil && (len(branch.Statements) > 0 || !last) {
+				out = append(out, branch.Statements...)
+				o.changed = true
+				continue
+			}
+			if branch == nil && !last {
+				o.changed = true
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// liveBranch returns the branch run by s when it is a condition known in
+// advance, nil when there is none
+func (o *optimizer) liveBranch(s ast.Statement) (*ast.BlockStatement, bool) {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ifExp, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	condition := literalObject(ifExp.Condition)
+	if condition == nil {
+		return nil, false
+	}
+	if evaluator.IsTruthy(condition) {
+		return ifExp.Consequence, true
+	}
+	return ifExp.Alternative, true
+}
+
+func (o *optimizer) statement(node ast.Statement) ast.Statement {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		node.Value = o.expression(node.Value)
+		o.bound[o.variable(node.Name)] = true
+	case *ast.AssignmentStatement:
+		node.Value = o.expression(node.Value)
+	case *ast.StructStatement:
+		for _, method := range node.Methods {
+			o.function(method.Function)
+		}
+	case *ast.ExportStatement:
+		node.Statement = o.statement(node.Statement)
+	case *ast.ReturnStatement:
+		node.ReturnValue = o.expression(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		node.Expression = o.expression(node.Expression)
+	case *ast.BlockStatement:
+		o.block(node)
+	}
+	return node
+}
+
+func (o *optimizer) expression(node ast.Expression) ast.Expression {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if literal, ok := o.inline(node); ok {
+			o.changed = true
+			return literal
+		}
+	case *ast.PrefixExpression:
+		node.Right = o.expression(node.Right)
+		if right := literalObject(node.Right); right != nil {
+			return o.fold(node, evaluator.PrefixOperation(node.Operator, right))
+		}
+	case *ast.InfixExpression:
+		node.Left = o.expression(node.Left)
+		node.Right = o.expression(node.Right)
+		left, right := literalObject(node.Left), literalObject(node.Right)
+		if left != nil && right != nil {
+			return o.fold(node, evaluator.InfixOperation(node.Operator, left, right))
+		}
+	case *ast.PostfixExpression:
+		node.Left = o.expression(node.Left)
+	case *ast.IfExpression:
+		node.Condition = o.expression(node.Condition)
+		o.block(node.Consequence)
+		o.block(node.Alternative)
+		o.pruneBranches(node)
+	case *ast.FunctionLiteral:
+		o.function(node)
+	case *ast.CallExpression:
+		node.Function = o.expression(node.Function)
+		o.expressions(node.Arguments)
+	case *ast.ArrayLiteral:
+		o.expressions(node.Elements)
+	case *ast.SetLiteral:
+		o.expressions(node.Elements)
+	case *ast.HashLiteral:
+		for i, pair := range node.Pairs {
+			node.Pairs[i].Key = o.expression(pair.Key)
+			node.Pairs[i].Value = o.expression(pair.Value)
+		}
+	case *ast.IndexExpression:
+		node.Left = o.expression(node.Left)
+		node.Index = o.expression(node.Index)
+	case *ast.SliceExpression:
+		node.Left = o.expression(node.Left)
+		node.Start = o.expression(node.Start)
+		node.End = o.expression(node.End)
+		node.Step = o.expression(node.Step)
+	case *ast.DotExpression:
+		node.Left = o.expression(node.Left)
+	}
+	return node
+}
+
+func (o *optimizer) expressions(expressions []ast.Expression) {
+	for i, exp := range expressions {
+		expressions[i] = o.expression(exp)
+	}
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) {
+	if block != nil {
+		block.Statements = o.statements(block.Statements)
+	}
+}
+
+func (o *optimizer) function(fn *ast.FunctionLiteral) {
+	o.functions = append(o.functions, fn)
+	o.block(fn.Body)
+	o.functions = o.functions[:len(o.functions)-1]
+}
+
+// pruneBranches drops the branch of a condition known in advance that never
+// runs, leaving a condition that always holds
+func (o *optimizer) pruneBranches(node *ast.IfExpression) {
+	condition := literalObject(node.Condition)
+	if condition == nil || node.Alternative == nil {
+		return
+	}
+	if !evaluator.IsTruthy(condition) {
+		node.Condition = newLiteral(evaluator.TRUE)
+		node.Consequence = node.Alternative
+	}
+	node.Alternative = nil
+	o.changed = true
+}
+
+// fold replaces node by the literal of its value, leaving the operators
+// failing at run time in place so they still report their error
+func (o *optimizer) fold(node ast.Expression, value object.Object) ast.Expression {
+	literal := newLiteral(value)
+	if literal == nil {
+		return node
+	}
+	o.changed = true
+	return literal
+}
+
+// inline returns the literal bound to the variable named by ident when it is
+// declared once, never changed and referenced after its let
+func (o *optimizer) inline(ident *ast.Identifier) (ast.Expression, bool) {
+	v := o.variable(ident)
+	literal, ok := o.literals[v]
+	if !ok || o.declarations[v] != 1 || !o.bound[v] {
+		return nil, false
+	}
+	return newLiteral(literalObject(literal)), true
+}
+
+func (o *optimizer) variable(ident *ast.Identifier) variable {
+	if ident.Binding == nil {
+		return variable{name: ident.Value}
+	}
+	fn := o.functions[len(o.functions)-1-ident.Binding.Depth]
+	return variable{fn: fn, slot: ident.Binding.Slot}
+}
+
+func isLiteral(node ast.Expression) bool {
+	return literalObject(node) != nil
+}
+
+// literalObject returns the value of an integer, string or boolean literal,
+// nil for any other expression
+func literalObject(node ast.Expression) object.Object {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		if node.Value {
+			return evaluator.TRUE
+		}
+		return evaluator.FALSE
+	}
+	return nil
+}
+
+// newLiteral returns the literal evaluating to value, nil when value has no
+// literal such as errors and collections
+func newLiteral(value object.Object) ast.Expression {
+	switch value := value.(type) {
+	case *object.Integer:
+		literal := strconv.FormatInt(value.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal}, Value: value.Value}
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: value.Value}, Value: value.Value}
+	case *object.Boolean:
+		if value.Value {
+			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/vm"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// constant folding
+		{"60 * 60 * 24", "86400"},
+		{"-(2 + 3) * 4", "-20"},
+		{`"hello" + " " + "world"`, "hello world"},
+		{"!(1 < 2) == false", "true"},
+		{`"a" in "abc"`, "true"},
+		{"1 / 0", "(1 / 0)"},
+		{`1 + "a"`, "(1 + a)"},
+		{"[1 + 1, {2 * 2: 3 - 3}]", "[2, {4:0}]"},
+
+		// dead branches
+		{"if (true) { 1 } else { 2 }; 3", "13"},
+		{"if (1 > 2) { 1 } else { 2 }; 3", "23"},
+		{"if (false) { 1 }; 3", "3"},
+		{"if (false) { 1 }", "iffalse 1"},
+		{"let a = if (1 == 2) { 1 } else { 2 };", "let a = iftrue 2;"},
+		{"let f = fn(x) { if (x) { 1 } else { 2 } };", "let f = fn(x) ifx 1 else 2;"},
+
+		// inlining
+		{"let day = 60 * 60 * 24; day * 7", "let day = 86400;604800"},
+		{"let a = 1; let b = a + 1; b", "let a = 1;let b = 2;2"},
+		{"let a = 1; a = 2; a", "let a = 1;a = 2;a"},
+		{"let f = fn(x) { let y = 2; x * y };", "let f = fn(x) let y = 2;(x * 2);"},
+		{"let f = fn(x) { let x = 2; x };", "let f = fn(x) let x = 2;x;"},
+		{"let f = fn(c) { if (c) { let y = 2 }; y };", "let f = fn(c) ifc let y = 2;y;"},
+		{"let a = [1]; a", "let a = [1];a"},
+		{"let debug = false; if (debug) { puts(1) }; 2", "let debug = false;2"},
+		{"let f = fn() { a }; let a = 1; f()", "let f = fn() a;let a = 1;f()"},
+		{"let a = 1; let f = fn() { a }; f()", "let a = 1;let f = fn() 1;f()"},
+	}
+
+	for _, tt := range tests {
+		program := optimize(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("%s: wrong program. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestOptimizedResultsMatch(t *testing.T) {
+	inputs := []string{
+		"60 * 60 * 24",
+		`let greeting = "hello"; let name = "world"; greeting + ", " + name`,
+		"let limit = 10; let f = fn(n) { if (n > limit) { limit } else { n } }; [f(5), f(50)]",
+		"let verbose = false; let log = []; if (verbose) { log = push(log, 1) }; log",
+		"let a = 1; let f = fn() { a = a + 1; a }; f(); f()",
+		"let f = fn(x) { let step = 2; if (true) { return x * step; }; 0 }; f(21)",
+		"let g = fn() { let k = 3; fn(x) { x * k } }; g()(4)",
+		"if (false) { 1 }",
+		"if (true) { let b = 2; }",
+		"let s = #{1 + 1, 2}; len(s)",
+		"struct P { x; fn double() { let two = 2; self.x * two } } P(4).double()",
+		"1 / 0",
+		`"a" - "b"`,
+		"let x = -(-5); let y = !true; [x, y, !!x]",
+		`let key = "k"; let h = {key: 1 + 1}; h[key]`,
+		"let f = fn() { a }; let r = f(); let a = 1; r",
+		"let g = fn() { let h = fn() { k }; let r = h(); let k = 3; r }; g()",
+		"struct S { fn get() { limit } } let early = S().get(); let limit = 5; [early, S().get()]",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+	}
+
+	for _, input := range inputs {
+		for _, backend := range []struct {
+			name string
+			eval func(*ast.Program, *object.Environment) object.Object
+		}{
+			{"evaluator", func(program *ast.Program, env *object.Environment) object.Object {
+				return evaluator.Eval(program, env)
+			}},
+			{"vm", vm.Eval},
+		} {
+			expected := backend.eval(parse(t, input), object.NewEnvironment())
+			optimized := backend.eval(optimize(t, input), object.NewEnvironment())
+
+			if optimized.Type() != expected.Type() || optimized.Inspect() != expected.Inspect() {
+				t.Errorf("%s on %s: optimized program returned %s %q, want %s %q", input, backend.name,
+					optimized.Type(), optimized.Inspect(), expected.Type(), expected.Inspect())
+			}
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser has errors: %v", errors)
+	}
+	env := object.NewEnvironment()
+	if errors := resolver.New(evaluator.Defined(env)).Resolve(program); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+	return program
+}
+
+func optimize(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	return Optimize(parse(t, input))
+}
@@ -20,7 +20,10 @@ const (
 	_ Precedence = iota
 	LOWEST
 	EQUALS      // ==
+	MEMBERSHIP  // in or not in
 	LESSGREATER // > or <
+	UNION       // |
+	INTERSECT   // &
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
@@ -33,8 +36,12 @@ const (
 var precedences = map[token.TokenType]Precedence{
 	token.EQ:        EQUALS,
 	token.NOTEQ:     EQUALS,
+	token.IN:        MEMBERSHIP,
+	token.NOT:       MEMBERSHIP,
 	token.LT:        LESSGREATER,
 	token.GT:        LESSGREATER,
+	token.PIPE:      UNION,
+	token.AMPERSAND: INTERSECT,
 	token.PLUS:      SUM,
 	token.MINUS:     SUM,
 	token.SLASH:     PRODUCT,
@@ -46,6 +53,19 @@ var precedences = map[token.TokenType]Precedence{
 	token.DOT:       DOT,
 }
 
+// OperatorPrecedence returns the precedence of an infix operator as written
+// in an InfixExpression, LOWEST for an unknown one
+func OperatorPrecedence(operator string) Precedence {
+	switch operator {
+	case "in", "not in":
+		return MEMBERSHIP
+	}
+	if precedence, ok := precedences[token.TokenType(operator)]; ok {
+		return precedence
+	}
+	return LOWEST
+}
+
 type Parser struct {
 	l *lexer.Lexer
 
@@ -54,6 +74,10 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
+	// depth counts the blocks enclosing the current token, imports and
+	// exports are only allowed at depth 0
+	depth int
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -70,6 +94,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.HASHBRACE, p.parseSetLiteral)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.IF, p.parseIfExpression)
@@ -97,6 +122,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOTEQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.NOT, p.parseNotInExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.DOT, p.parseDotExpression)
@@ -166,6 +195,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	case token.IDENT:
 		if p.peekTokenIs(token.ASSIGN) {
 			return p.parseAssignmentStatement()
@@ -217,10 +252,151 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// parseStructStatement parses the fields and methods of a struct, fields are
+// separated by commas or semicolons and methods use the fn keyword followed by
+// their name
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.nextToken()
+
+	members := map[string]bool{}
+	declare := func(name *ast.Identifier) bool {
+		if members[name.Value] {
+			p.errors = append(p.errors, fmt.Sprintf("duplicate member %s in struct %s", name.Value, stmt.Name.Value))
+			return false
+		}
+		members[name.Value] = true
+		return true
+	}
+
+	for !p.curTokenIs(token.RBRACE) {
+		switch p.curToken.Type {
+		case token.COMMA, token.SEMICOLON:
+		case token.IDENT:
+			field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !declare(field) {
+				return nil
+			}
+			stmt.Fields = append(stmt.Fields, field)
+		case token.FUNCTION:
+			method := p.parseMethod()
+			if method == nil || !declare(method.Name) {
+				return nil
+			}
+			stmt.Methods = append(stmt.Methods, method)
+		default:
+			msg := fmt.Sprintf("unexpected %s in struct %s", p.curToken.Type, stmt.Name.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		p.nextToken()
+	}
+	stmt.Close = p.curToken
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	topLevel := p.atTopLevel()
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if !topLevel {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+	topLevel := p.atTopLevel()
+
+	p.nextToken()
+	switch p.curToken.Type {
+	case token.LET:
+		if let := p.parseLetStatement(); let != nil {
+			stmt.Statement = let
+		}
+	case token.STRUCT:
+		if structStmt := p.parseStructStatement(); structStmt != nil {
+			stmt.Statement = structStmt
+		}
+	default:
+		msg := fmt.Sprintf("cannot export %s, only let and struct statements", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+	}
+
+	if !topLevel || stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+// atTopLevel reports whether the current statement is outside any block,
+// recording an error otherwise. The statement is still parsed, then
+// dropped, so its remaining tokens cause no further errors.
+func (p *Parser) atTopLevel() bool {
+	if p.depth > 0 {
+		msg := fmt.Sprintf("%s is only allowed at the top level", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return false
+	}
+	return true
+}
+
+func (p *Parser) parseMethod() *ast.Method {
+	fn := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	fn.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	fn.Body = p.parseBlockStatement()
+
+	return &ast.Method{Name: name, Function: fn}
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	p.depth++
+	defer func() { p.depth-- }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -230,6 +406,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Close = p.curToken
 	return block
 }
 
@@ -311,13 +488,23 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	arr := &ast.ArrayLiteral{Token: p.curToken}
 
 	arr.Elements = p.parseExpressionList(token.RBRACKET)
+	arr.Close = p.curToken
 
 	return arr
 }
 
+func (p *Parser) parseSetLiteral() ast.Expression {
+	set := &ast.SetLiteral{Token: p.curToken}
+
+	set.Elements = p.parseExpressionList(token.RBRACE)
+	set.Close = p.curToken
+
+	return set
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []ast.HashPair{}
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -330,7 +517,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
-		hash.Pairs[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -340,6 +527,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Close = p.curToken
 
 	return hash
 }
@@ -500,28 +688,89 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseNotInExpression parses `not in`, the only place where the not keyword
+// is allowed, as a single infix operator
+func (p *Parser) parseNotInExpression(left ast.Expression) ast.Expression {
+	exp := &ast.InfixExpression{
+		Token: p.curToken,
+		Left:  left,
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	exp.Operator = "not in"
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	exp.Right = p.parseExpression(precedence)
+
+	return exp
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{
 		Token:    p.curToken,
 		Function: function,
 	}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Close = p.curToken
 	return exp
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{
-		Token: p.curToken,
+	start := p.curToken
+
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(start, left, index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return &ast.IndexExpression{Token: start, Left: left, Index: index, Close: p.curToken}
+}
+
+// parseSliceExpression parses the rest of left[start:end:step] with the
+// current token right before the first colon
+func (p *Parser) parseSliceExpression(lbracket token.Token, left ast.Expression, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{
+		Token: lbracket,
 		Left:  left,
+		Start: start,
 	}
+
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	exp.End = p.parseSliceBound()
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Step = p.parseSliceBound()
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Close = p.curToken
 	return exp
 }
 
+// parseSliceBound parses the expression following the current colon, or
+// returns nil when the bound is omitted
+func (p *Parser) parseSliceBound() ast.Expression {
+	if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.RBRACKET) {
+		return nil
+	}
+	p.nextToken()
+	return p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
 	exp := &ast.DotExpression{
 		Token: p.curToken,
@@ -163,6 +163,161 @@ func testAssignmentStatement(t *testing.T, stmt ast.Statement, name string, valu
 	return testLiteralExpression(t, assignment.Value, value)
 }
 
+func TestStructStatements(t *testing.T) {
+	input := `
+	struct Point {
+		x, y;
+		fn sum() { self.x + self.y }
+		fn scale(k, j) { Point(self.x * k, self.y * j) }
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.StructStatement. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, stmt.Name, "Point")
+
+	if len(stmt.Fields) != 2 {
+		t.Fatalf("struct does not have 2 fields. got=%d", len(stmt.Fields))
+	}
+	testIdentifier(t, stmt.Fields[0], "x")
+	testIdentifier(t, stmt.Fields[1], "y")
+
+	if len(stmt.Methods) != 2 {
+		t.Fatalf("struct does not have 2 methods. got=%d", len(stmt.Methods))
+	}
+	testIdentifier(t, stmt.Methods[0].Name, "sum")
+	testIdentifier(t, stmt.Methods[1].Name, "scale")
+	if len(stmt.Methods[1].Function.Parameters) != 2 {
+		t.Fatalf("method scale does not have 2 parameters. got=%d", len(stmt.Methods[1].Function.Parameters))
+	}
+
+	expected := "struct Point { x, y; fn sum() ((self.x) + (self.y)); " +
+		"fn scale(k, j) Point(((self.x) * k), ((self.y) * j)) }"
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestStructStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, x }", "duplicate member x in struct Point"},
+		{"struct Point { x; fn x() {} }", "duplicate member x in struct Point"},
+		{"struct Point { 1 }", "unexpected INT in struct Point"},
+		{"struct Point { x", "unexpected EOF in struct Point"},
+		{"struct { x }", "expected next token to be IDENT, got { instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestImportExportStatements(t *testing.T) {
+	input := `
+	import "lib/strings.m" as s;
+	export let x = 5;
+	export struct Point { x, y }
+	`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	imp, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if imp.Path.Value != "lib/strings.m" {
+		t.Errorf("imp.Path.Value not %q. got=%q", "lib/strings.m", imp.Path.Value)
+	}
+	testIdentifier(t, imp.Alias, "s")
+
+	expected := []string{"x", "Point"}
+	for i, name := range expected {
+		export, ok := program.Statements[i+1].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not ast.ExportStatement. got=%T", i+1, program.Statements[i+1])
+		}
+		testIdentifier(t, export.Name(), name)
+	}
+
+	if program.String() != `import "lib/strings.m" as s;export let x = 5;export struct Point { x, y }` {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestImportExportStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"import lib as l", "expected next token to be STRING, got lib instead"},
+		{`import "lib.m"`, "expected next token to be AS, got  instead"},
+		{"export 5", "cannot export INT, only let and struct statements"},
+		{"fn() { export let x = 1; }", "export is only allowed at the top level"},
+		{`if (true) { import "lib.m" as l }`, "import is only allowed at the top level"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+// TestNestedImportExport checks that statements rejected away from the top
+// level are skipped whole, reporting a single error
+func TestNestedImportExport(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`if (true) { import "lib.m" as l }`, "import is only allowed at the top level"},
+		{`fn() { import "lib.m" as l; l }`, "import is only allowed at the top level"},
+		{"fn() { export let x = 1; x }", "export is only allowed at the top level"},
+		{"fn() { export struct P { x } }", "export is only allowed at the top level"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestIdentifierExpressions(t *testing.T) {
 	input := "foobar;"
 
@@ -299,6 +454,33 @@ func TestParsingArrayLiterals(t *testing.T) {
 	testInfixExpression(t, arr.Elements[2], 3, "+", 3)
 }
 
+func TestParsingSetLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#{1, 2 * 2, a}", "#{1, (2 * 2), a}"},
+		{"#{}", "#{}"},
+		{"#{#{1}}", "#{#{1}}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		set, ok := stmt.Expression.(*ast.SetLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.SetLiteral. got=%T", stmt.Expression)
+		}
+		if set.String() != tt.expected {
+			t.Errorf("set.String() wrong. got=%q, want=%q", set.String(), tt.expected)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -358,7 +540,8 @@ func TestParsingHashLiteralsWithStringKeys(t *testing.T) {
 		"three": 3,
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("hash key is not ast.StringLiteral. got=%T", key)
@@ -401,7 +584,8 @@ func TestParsingHashLiteralsWithBooleanKeys(t *testing.T) {
 		false: 0,
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.Boolean)
 		if !ok {
 			t.Errorf("hash key is not ast.Boolean. got=%T", key)
@@ -445,7 +629,8 @@ func TestParsingHashLiteralsWithIntegerKeys(t *testing.T) {
 		int64(2): "two",
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.IntegerLiteral)
 		if !ok {
 			t.Errorf("hash key is not ast.IntegerLiteral. got=%T", key)
@@ -495,7 +680,8 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("hash key is not ast.StringLiteral. got=%T", key)
@@ -512,6 +698,35 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingHashLiteralsPreserveOrder(t *testing.T) {
+	input := `{"b": 1, "a": 2, 3: 3, "c": 4}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []string{"b", "a", "3", "c"}
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash does not have %d pairs. got=%d", len(expected), len(hash.Pairs))
+	}
+	for i, pair := range hash.Pairs {
+		if pair.Key.TokenLiteral() != expected[i] {
+			t.Errorf("hash key %d is not %q. got=%q", i, expected[i], pair.Key.TokenLiteral())
+		}
+	}
+
+	if hash.String() != "{b:1, a:2, 3:3, c:4}" {
+		t.Errorf("hash.String() wrong. got=%q", hash.String())
+	}
+}
+
 func TestParsingIndexExpressions(t *testing.T) {
 	input := "myArray[1 + 1]"
 
@@ -542,6 +757,61 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		start    any
+		end      any
+		step     any
+		expected string
+	}{
+		{"a[1:3]", 1, 3, nil, "(a[1:3])"},
+		{"a[:n]", nil, "n", nil, "(a[:n])"},
+		{"a[1:]", 1, nil, nil, "(a[1:])"},
+		{"a[:]", nil, nil, nil, "(a[:])"},
+		{"a[::2]", nil, nil, 2, "(a[::2])"},
+		{"a[1::x]", 1, nil, "x", "(a[1::x])"},
+		{"a[:-1:-1]", nil, "-1", "-1", "(a[:(-1):(-1)])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.SliceExpression. got=%T", stmt.Expression)
+		}
+		testIdentifier(t, slice.Left, "a")
+
+		bounds := []struct {
+			exp      ast.Expression
+			expected any
+		}{{slice.Start, tt.start}, {slice.End, tt.end}, {slice.Step, tt.step}}
+		for _, bound := range bounds {
+			switch expected := bound.expected.(type) {
+			case nil:
+				if bound.exp != nil {
+					t.Errorf("bound of %q is not nil. got=%s", tt.input, bound.exp)
+				}
+			case int:
+				testLiteralExpression(t, bound.exp, expected)
+			case string:
+				if bound.exp == nil || bound.exp.String() != expected && bound.exp.String() != "("+expected+")" {
+					t.Errorf("bound of %q is not %s. got=%v", tt.input, expected, bound.exp)
+				}
+			}
+		}
+
+		if slice.String() != tt.expected {
+			t.Errorf("slice.String() wrong. got=%q, want=%q", slice.String(), tt.expected)
+		}
+	}
+}
+
 func TestHashDotExpressions(t *testing.T) {
 	input := "person.name"
 
@@ -926,6 +1196,10 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true != false;", true, "!=", false},
 		{"true == true;", true, "==", true},
 		{"false == false;", false, "==", false},
+		{"a in b;", "a", "in", "b"},
+		{"a not in b;", "a", "not in", "b"},
+		{"a | b;", "a", "|", "b"},
+		{"a & b;", "a", "&", "b"},
 	}
 
 	for _, tt := range infixTests {
@@ -949,6 +1223,21 @@ func TestParsingInfixExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingNotWithoutIn(t *testing.T) {
+	l := lexer.New("a not b")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors for a lone not")
+	}
+	expected := "expected next token to be IN, got b instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
 func TestOperatorPrecedenceParsing(t *testing.T) {
 	infixTests := []struct {
 		input    string
@@ -966,6 +1255,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a;",
 			"(!(-a))",
 		},
+		{
+			"a + b in c * d == true",
+			"(((a + b) in (c * d)) == true)",
+		},
+		{
+			"a not in b != c < d",
+			"((a not in b) != (c < d))",
+		},
+		{
+			"a in b in c",
+			"((a in b) in c)",
+		},
+		{
+			"a | b & c - d",
+			"(a | (b & (c - d)))",
+		},
+		{
+			"x in a & b | c == d",
+			"((x in ((a & b) | c)) == d)",
+		},
 		{
 			"a + b + c;",
 			"((a + b) + c)",
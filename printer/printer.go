@@ -0,0 +1,516 @@
+// Package printer writes Monkey programs in their canonical style: two spaces
+// of indentation, one statement per line and a semicolon after every
+// statement but the last of a block and the ones ending with a block, which
+// take one only when the next statement would continue them.
+//
+// The layout of the source is kept where it carries meaning: comments, single
+// blank lines between statements, and whether blocks, collection literals and
+// arguments span one line or several. Collections and arguments spanning
+// several lines get an element per line, each followed by a comma.
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+const indentation = "  "
+
+// Format parses src and returns it in the canonical style, or the errors
+// of the parser
+func Format(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	var out bytes.Buffer
+	if err := Fprint(&out, program, l.Comments()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Fprint writes program to w in the canonical style, placing the comments
+// read by the lexer from its source by their position
+func Fprint(w io.Writer, program *ast.Program, comments []token.Token) error {
+	p := &printer{comments: comments, lineStart: true, first: true, semicolon: -1}
+	p.statements(program.Statements, false)
+	p.commentsBefore(ast.Position{Line: math.MaxInt})
+	_, err := w.Write(p.out)
+	return err
+}
+
+type printer struct {
+	out       []byte
+	indent    int
+	lineStart bool // nothing but the indentation is due on the current line
+
+	comments []token.Token
+	next     int // index of the first comment not printed yet
+
+	// lastLine is the line in the source of the last statement or comment
+	// printed, to keep the blank lines following it. first is set until the
+	// first of the statements of a block is printed, as blocks do not start
+	// with a blank line.
+	lastLine int
+	first    bool
+
+	// semicolon is the offset in out after the if expression ending the last
+	// statement printed, where a semicolon goes when the next statement would
+	// continue it, -1 when there is none
+	semicolon int
+}
+
+func (p *printer) write(s string) {
+	if s == "" {
+		return
+	}
+	if p.lineStart {
+		p.out = append(p.out, strings.Repeat(indentation, p.indent)...)
+		p.lineStart = false
+	}
+	p.out = append(p.out, s...)
+}
+
+func (p *printer) newline() {
+	p.out = append(p.out, '\n')
+	p.lineStart = true
+}
+
+// blankLine keeps a blank line before what starts at line in the source when
+// there was one after the last thing printed
+func (p *printer) blankLine(line int) {
+	if !p.first && p.lastLine > 0 && line > p.lastLine+1 {
+		p.newline()
+	}
+	p.first = false
+}
+
+// commentsBefore prints the comments placed before pos, one per line
+func (p *printer) commentsBefore(pos ast.Position) {
+	for p.next < len(p.comments) {
+		comment := p.comments[p.next]
+		if !before(comment, pos) {
+			return
+		}
+		p.blankLine(comment.Line)
+		p.write(comment.Literal)
+		p.newline()
+		p.lastLine = comment.Line
+		p.next++
+	}
+}
+
+// trailingComment prints the comment following the last thing printed on
+// its line in the source
+func (p *printer) trailingComment(line int) {
+	if p.next < len(p.comments) && p.comments[p.next].Line == line {
+		p.write(" " + p.comments[p.next].Literal)
+		p.next++
+	}
+}
+
+func (p *printer) hasCommentBefore(tok token.Token) bool {
+	return p.next < len(p.comments) && before(p.comments[p.next], ast.Position{Line: tok.Line, Column: tok.Column})
+}
+
+func before(comment token.Token, pos ast.Position) bool {
+	return comment.Line < pos.Line || comment.Line == pos.Line && comment.Column < pos.Column
+}
+
+// statements prints the statements of a program or a block, with the
+// comments and blank lines before them
+func (p *printer) statements(list []ast.Statement, block bool) {
+	for i, s := range list {
+		span := ast.SpanOf(s)
+		p.commentsBefore(span.Start)
+		p.blankLine(span.Start.Line)
+
+		previous := p.semicolon
+		p.semicolon = -1
+		start := len(p.out)
+		p.statement(s, block && i == len(list)-1)
+		if previous >= 0 && continues(p.out[start:]) {
+			p.out = append(p.out[:previous], append([]byte{';'}, p.out[previous:]...)...)
+			if p.semicolon >= 0 {
+				p.semicolon++
+			}
+		}
+
+		if span.End.Line > p.lastLine {
+			p.lastLine = span.End.Line
+		}
+		p.trailingComment(span.End.Line)
+		p.newline()
+	}
+	p.semicolon = -1
+}
+
+// continues reports whether a statement printed as out would be parsed as
+// part of the expression before it, when it starts with an infix operator
+func continues(out []byte) bool {
+	out = bytes.TrimLeft(out, " ")
+	return len(out) > 0 && strings.IndexByte("([-", out[0]) >= 0
+}
+
+// statement prints s, ending it with a semicolon unless it is the last of
+// its block
+func (p *printer) statement(s ast.Statement, last bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write("let " + s.Name.Value + " = ")
+		p.expression(s.Value, parser.LOWEST)
+		p.semicolonUnless(last)
+	case *ast.AssignmentStatement:
+		p.write(s.Name.Value + " = ")
+		p.expression(s.Value, parser.LOWEST)
+		p.semicolonUnless(last)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue == nil {
+			// a return without value needs its semicolon to tell it from
+			// one returning the expression following it
+			p.write(";")
+			return
+		}
+		p.write(" ")
+		p.expression(s.ReturnValue, parser.LOWEST)
+		p.semicolonUnless(last)
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+		if _, ok := s.Expression.(*ast.IfExpression); ok {
+			if !last {
+				p.semicolon = len(p.out)
+			}
+			return
+		}
+		p.semicolonUnless(last)
+	case *ast.StructStatement:
+		p.structStatement(s)
+	case *ast.ImportStatement:
+		p.write("import " + quote(s.Path.Value) + " as " + s.Alias.Value + ";")
+	case *ast.ExportStatement:
+		p.write("export ")
+		p.statement(s.Statement, false)
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+func (p *printer) semicolonUnless(last bool) {
+	if !last {
+		p.write(";")
+	}
+}
+
+func (p *printer) structStatement(s *ast.StructStatement) {
+	p.write("struct " + s.Name.Value + " ")
+	if len(s.Fields) == 0 && len(s.Methods) == 0 && !p.hasCommentBefore(s.Close) {
+		p.write("{}")
+		return
+	}
+
+	fields := make([]string, len(s.Fields))
+	for i, field := range s.Fields {
+		fields[i] = field.Value
+	}
+
+	if !spansLines(s.Token, s.Close) && !p.hasCommentBefore(s.Close) {
+		p.write("{ " + strings.Join(fields, ", "))
+		for i, method := range s.Methods {
+			if i > 0 || len(fields) > 0 {
+				p.write("; ")
+			}
+			p.method(method)
+		}
+		p.write(" }")
+		return
+	}
+
+	p.enterBlock(s.Token.Line)
+	if len(fields) > 0 {
+		first := ast.SpanOf(s.Fields[0]).Start
+		last := ast.SpanOf(s.Fields[len(s.Fields)-1]).End
+		p.commentsBefore(first)
+		p.blankLine(first.Line)
+		p.write(strings.Join(fields, ", "))
+		p.lastLine = last.Line
+		p.trailingComment(last.Line)
+		p.newline()
+	}
+	for _, method := range s.Methods {
+		span := ast.SpanOf(method.Function)
+		p.commentsBefore(span.Start)
+		p.blankLine(span.Start.Line)
+		p.method(method)
+		p.lastLine = span.End.Line
+		p.trailingComment(span.End.Line)
+		p.newline()
+	}
+	p.leaveBlock(s.Close)
+}
+
+func (p *printer) method(method *ast.Method) {
+	p.write("fn " + method.Name.Value)
+	p.parameters(method.Function.Parameters)
+	p.write(" ")
+	p.block(method.Function.Body)
+}
+
+func (p *printer) parameters(params []*ast.Identifier) {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Value
+	}
+	p.write("(" + strings.Join(names, ", ") + ")")
+}
+
+// block prints a block on a single line when it holds at most a statement
+// and did in the source
+func (p *printer) block(b *ast.BlockStatement) {
+	if !p.hasCommentBefore(b.Close) {
+		switch {
+		case len(b.Statements) == 0:
+			p.write("{}")
+			return
+		case len(b.Statements) == 1 && !spansLines(b.Token, b.Close):
+			p.write("{ ")
+			p.statement(b.Statements[0], true)
+			p.write(" }")
+			return
+		}
+	}
+
+	p.enterBlock(b.Token.Line)
+	p.statements(b.Statements, true)
+	p.leaveBlock(b.Close)
+}
+
+// enterBlock opens a brace, the lines following it being indented
+func (p *printer) enterBlock(line int) {
+	p.write("{")
+	p.newline()
+	p.indent++
+	p.lastLine = line
+	p.first = true
+}
+
+// leaveBlock prints the comments left before the closing brace and closes it
+func (p *printer) leaveBlock(close token.Token) {
+	p.commentsBefore(ast.Position{Line: close.Line, Column: close.Column})
+	p.indent--
+	p.write("}")
+	p.lastLine = close.Line
+	p.first = false
+}
+
+func spansLines(open, close token.Token) bool {
+	return open.Line > 0 && close.Line > open.Line
+}
+
+// expression prints exp, between parentheses when it binds less tightly
+// than precedence, the one required where it appears
+func (p *printer) expression(exp ast.Expression, precedence parser.Precedence) {
+	if precedenceOf(exp) < precedence {
+		p.write("(")
+		p.expression(exp, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		if exp.Token.Literal == "" {
+			p.write(strconv.FormatInt(exp.Value, 10))
+		} else {
+			p.write(exp.Token.Literal)
+		}
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(exp.Value))
+	case *ast.StringLiteral:
+		p.write(quote(exp.Value))
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		// - -x would read as a decrement
+		if last := exp.Operator[len(exp.Operator)-1]; (last == '-' || last == '+') && startsWith(exp.Right, last) {
+			p.expression(exp.Right, parser.POSTFIX)
+		} else {
+			p.expression(exp.Right, parser.PREFIX)
+		}
+	case *ast.InfixExpression:
+		operator := parser.OperatorPrecedence(exp.Operator)
+		p.expression(exp.Left, operator)
+		p.write(" " + exp.Operator + " ")
+		// operators group to the left, so the right operand of an operator
+		// of the same precedence needs parentheses
+		p.expression(exp.Right, operator+1)
+	case *ast.PostfixExpression:
+		p.expression(exp.Left, parser.POSTFIX)
+		p.write(exp.Operator)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn")
+		p.parameters(exp.Parameters)
+		p.write(" ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.expression(exp.Function, parser.CALL)
+		p.expressions("(", exp.Arguments, ")", exp.Token, exp.Close)
+	case *ast.ArrayLiteral:
+		p.expressions("[", exp.Elements, "]", exp.Token, exp.Close)
+	case *ast.SetLiteral:
+		p.expressions("#{", exp.Elements, "}", exp.Token, exp.Close)
+	case *ast.HashLiteral:
+		p.list("{", len(exp.Pairs), "}", exp.Token, exp.Close, func(i int) ast.Span {
+			return ast.Span{Start: ast.SpanOf(exp.Pairs[i].Key).Start, End: ast.SpanOf(exp.Pairs[i].Value).End}
+		}, func(i int) {
+			p.expression(exp.Pairs[i].Key, parser.LOWEST)
+			p.write(": ")
+			p.expression(exp.Pairs[i].Value, parser.LOWEST)
+		})
+	case *ast.IndexExpression:
+		p.expression(exp.Left, parser.CALL)
+		p.write("[")
+		p.expression(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.SliceExpression:
+		p.expression(exp.Left, parser.CALL)
+		p.write("[")
+		p.optional(exp.Start)
+		p.write(":")
+		p.optional(exp.End)
+		if exp.Step != nil {
+			p.write(":")
+			p.optional(exp.Step)
+		}
+		p.write("]")
+	case *ast.DotExpression:
+		p.expression(exp.Left, parser.CALL)
+		p.write("." + exp.Right.Value)
+	}
+}
+
+func (p *printer) optional(exp ast.Expression) {
+	if exp != nil {
+		p.expression(exp, parser.LOWEST)
+	}
+}
+
+func (p *printer) expressions(open string, list []ast.Expression, close string, openTok, closeTok token.Token) {
+	p.list(open, len(list), close, openTok, closeTok, func(i int) ast.Span {
+		return ast.SpanOf(list[i])
+	}, func(i int) {
+		p.expression(list[i], parser.LOWEST)
+	})
+}
+
+// list prints the n elements of a collection or the arguments of a call,
+// on a line or one per line as in the source
+func (p *printer) list(open string, n int, close string, openTok, closeTok token.Token, span func(int) ast.Span, element func(int)) {
+	if !spansLines(openTok, closeTok) && !p.hasCommentBefore(closeTok) {
+		p.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			element(i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.write(open)
+	p.newline()
+	p.indent++
+	p.lastLine = openTok.Line
+	p.first = true
+	for i := 0; i < n; i++ {
+		s := span(i)
+		p.commentsBefore(s.Start)
+		p.blankLine(s.Start.Line)
+		element(i)
+		p.write(",")
+		p.lastLine = s.End.Line
+		p.trailingComment(s.End.Line)
+		p.newline()
+	}
+	p.commentsBefore(ast.Position{Line: closeTok.Line, Column: closeTok.Column})
+	p.indent--
+	p.write(close)
+	p.lastLine = closeTok.Line
+	p.first = false
+}
+
+// precedenceOf returns the precedence of the operator applied last by exp,
+// above all the others for the expressions needing no parentheses
+func precedenceOf(exp ast.Expression) parser.Precedence {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.OperatorPrecedence(exp.Operator)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.IntegerLiteral:
+		if exp.Value < 0 {
+			return parser.PREFIX
+		}
+	case *ast.PostfixExpression:
+		return parser.POSTFIX
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression, *ast.DotExpression:
+		return parser.CALL
+	}
+	return parser.DOT + 1
+}
+
+// startsWith reports whether exp, printed without parentheses, starts with c
+func startsWith(exp ast.Expression, c byte) bool {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return exp.Operator[0] == c
+	case *ast.IntegerLiteral:
+		return exp.Value < 0 && c == '-'
+	}
+	return false
+}
+
+// quote writes a string literal, escaping what the lexer reads as escapes
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,124 @@
+package printer
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// spacing and semicolons
+		{"let x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"let a = [1,2,3]", "let a = [1, 2, 3];\n"},
+		{`let h = {"a": 1, "b": 2}`, "let h = {\"a\": 1, \"b\": 2};\n"},
+		{"let s = #{1, 2}", "let s = #{1, 2};\n"},
+		{"let f = fn(x, y) { x + y }", "let f = fn(x, y) { x + y };\n"},
+		{"a[1:2]; a.b.c(1)", "a[1:2];\na.b.c(1);\n"},
+		{"x not in [1]", "x not in [1];\n"},
+		{`import "math" as m`, "import \"math\" as m;\n"},
+		{"return", "return;\n"},
+		{`puts("a\tb\"c\n")`, "puts(\"a\\tb\\\"c\\n\");\n"},
+
+		// parentheses
+		{"let x = (1 + 2) * 3;", "let x = (1 + 2) * 3;\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3);\n"},
+		{"(1 - 2) - 3", "1 - 2 - 3;\n"},
+		{"-(-x)", "-(-x);\n"},
+		{"!(a == b)", "!(a == b);\n"},
+		{"(a + b)[0]", "(a + b)[0];\n"},
+
+		// statements ending with a block
+		{"if (a) { 1 }\nputs(1)", "if (a) { 1 }\nputs(1);\n"},
+		{"if (a) { 1 };\n[1][0]", "if (a) { 1 };\n[1][0];\n"},
+		{"if (a) { 1 } else { 2 };\n-1", "if (a) { 1 } else { 2 };\n-1;\n"},
+
+		// layout
+		{"let f = fn(x) {\nlet y = x\n\n\n y }", "let f = fn(x) {\n  let y = x;\n\n  y\n};\n"},
+		{"let f = fn(x) { let y = x; y }", "let f = fn(x) {\n  let y = x;\n  y\n};\n"},
+		{"let a = [\n1,\n2]", "let a = [\n  1,\n  2,\n];\n"},
+		{"\n\nlet a = 1\n\n\n\nlet b = 2\n\n", "let a = 1;\n\nlet b = 2;\n"},
+		{
+			"struct Point { x, y\n fn norm() { x * x + y * y } }",
+			"struct Point {\n  x, y\n  fn norm() { x * x + y * y }\n}\n",
+		},
+
+		// comments
+		{"let x = 1 # one\n# two\nlet y = 2", "let x = 1; # one\n# two\nlet y = 2;\n"},
+		{"fn() {\n  1\n  # end\n}", "fn() {\n  1\n  # end\n};\n"},
+		{"fn() { 1 # one\n}", "fn() {\n  1 # one\n};\n"},
+		{"let x = 1\n# last", "let x = 1;\n# last\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := Format([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err)
+			continue
+		}
+		if string(out) != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot =%q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	_, err := Format([]byte("let = 1"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if err.Error() != "expected next token to be IDENT, got = instead\nno prefix parse function for = found" {
+		t.Errorf("wrong error. got=%q", err)
+	}
+}
+
+// TestFormatExamples checks that formatting the examples changes nothing the
+// parser sees, and that formatted programs are left as they are
+func TestFormatExamples(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, ok := parse(string(src))
+		if !ok {
+			continue
+		}
+
+		out, err := Format(src)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", file, err)
+			continue
+		}
+		if got, _ := parse(string(out)); got != want {
+			t.Errorf("%s: formatting changed the program.\nwant=%q\ngot =%q", file, want, got)
+		}
+
+		again, err := Format(out)
+		if err != nil {
+			t.Errorf("%s: unexpected error formatting again: %s", file, err)
+			continue
+		}
+		if string(again) != string(out) {
+			t.Errorf("%s: formatting is not idempotent.\nfirst =%q\nsecond=%q", file, out, again)
+		}
+	}
+}
+
+// parse returns the program in src as printed by the ast, false when it has
+// errors
+func parse(src string) (string, bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	return program.String(), len(p.Errors()) == 0
+}
@@ -5,43 +5,59 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/resolver"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// Evaluator runs a line once parsed
+type Evaluator func(program *ast.Program, env *object.Environment) object.Object
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	Run(in, out, object.NewEnvironment())
+}
+
+// Run starts a session evaluating every line in env
+func Run(in io.Reader, out io.Writer, env *object.Environment) {
+	RunWith(in, out, env, func(program *ast.Program, env *object.Environment) object.Object {
+		return evaluator.Eval(program, env)
+	})
+}
 
-	env := object.NewEnvironment()
+// RunWith starts a session running every line in env with eval
+func RunWith(in io.Reader, out io.Writer, env *object.Environment, eval Evaluator) {
+	// The reader is shared with the environment so the input builtin and the
+	// prompt consume the same buffered stream
+	reader := bufio.NewReader(in)
+	env.SetIO(reader, out, out)
+	r := resolver.New(evaluator.Defined(env))
 
 	for {
 		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-
-		// for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-		// fmt.Fprintln(out, "Token:")
-		// fmt.Fprintf(out, "%+v\n", tok)
-		// }
-		// l.Reset()
+		l := lexer.New(strings.TrimRight(line, "\r\n"))
 		p := parser.New(l)
 		program := p.ParseProgram()
 		errors := p.Errors()
+		if len(errors) == 0 {
+			errors = r.Resolve(program)
+		}
 		if len(errors) > 0 {
 			printParseErrors(out, errors)
 			continue
 		}
 
-		result := evaluator.Eval(program, env)
+		result := eval(program, env)
 		if result != nil {
 			fmt.Fprintln(out, result.Inspect())
 		}
@@ -0,0 +1,250 @@
+// Package resolver binds the identifiers of a program to the variables they
+// name before it runs. Locals are given the slot they live in among the
+// locals of their function, and the depth of that function from the one
+// referencing them, so the evaluator reaches them without looking names up.
+//
+// Code runs top to bottom, so a reference sees the variables declared before
+// it. Function bodies run once called, so they are resolved at the end of the
+// function or program declaring them and see all of its variables.
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+)
+
+// scope holds the variables declared by a function, or by the program for
+// the outermost scope. Blocks share the scope of their function, as they
+// share its environment in the evaluator.
+type scope struct {
+	outer *scope
+	fn    *ast.FunctionLiteral // nil for the program
+
+	slots  map[string]int
+	locals []string
+
+	// functions lists the function literals to resolve once the scope has
+	// declared all of its variables
+	functions []function
+}
+
+type function struct {
+	literal *ast.FunctionLiteral
+	method  bool
+}
+
+// Resolver keeps the globals declared by the programs resolved so far, as
+// the lines of the REPL see the ones before them
+type Resolver struct {
+	defined func(name string) bool
+	globals map[string]bool
+
+	scope *scope
+	// blocks holds the names declared by the blocks being resolved, the last
+	// one being the innermost, to report a name declared twice in a block
+	blocks []map[string]bool
+	errors []string
+}
+
+// New creates a resolver for programs run where defined reports the names
+// already bound, such as builtins
+func New(defined func(name string) bool) *Resolver {
+	return &Resolver{defined: defined, globals: map[string]bool{}}
+}
+
+// Resolve binds the identifiers of program and returns the errors found
+func (r *Resolver) Resolve(program *ast.Program) []string {
+	r.errors = []string{}
+	r.scope = &scope{}
+
+	globals := make(map[string]bool, len(r.globals))
+	for name := range r.globals {
+		globals[name] = true
+	}
+
+	r.enterBlock()
+	r.resolveStatements(program.Statements)
+	r.leaveBlock()
+	r.resolveFunctions()
+
+	// a program with errors never runs, so it declares nothing
+	if len(r.errors) > 0 {
+		r.globals = globals
+	}
+	return r.errors
+}
+
+func (r *Resolver) resolveStatements(statements []ast.Statement) {
+	for _, s := range statements {
+		r.resolveStatement(s)
+	}
+}
+
+func (r *Resolver) resolveStatement(node ast.Statement) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		r.resolveExpression(node.Expression)
+	case *ast.LetStatement:
+		r.resolveExpression(node.Value)
+		r.declare(node.Name)
+	case *ast.AssignmentStatement:
+		r.resolveExpression(node.Value)
+		if !r.bind(node.Name) {
+			r.errorf("assign to an undefined identifier %s", node.Name.Value)
+		}
+	case *ast.ReturnStatement:
+		r.resolveExpression(node.ReturnValue)
+	case *ast.BlockStatement:
+		r.resolveBlock(node)
+	case *ast.StructStatement:
+		r.declare(node.Name)
+		for _, method := range node.Methods {
+			r.scope.functions = append(r.scope.functions, function{method.Function, true})
+		}
+	case *ast.ImportStatement:
+		r.declare(node.Alias)
+	case *ast.ExportStatement:
+		r.resolveStatement(node.Statement)
+	}
+}
+
+func (r *Resolver) resolveBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	r.enterBlock()
+	r.resolveStatements(block.Statements)
+	r.leaveBlock()
+}
+
+func (r *Resolver) resolveExpression(node ast.Expression) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if !r.bind(node) {
+			r.errorf("identifier %s is undefined", node.Value)
+		}
+	case *ast.PrefixExpression:
+		r.resolveExpression(node.Right)
+	case *ast.InfixExpression:
+		r.resolveExpression(node.Left)
+		r.resolveExpression(node.Right)
+	case *ast.PostfixExpression:
+		r.resolveExpression(node.Left)
+	case *ast.IfExpression:
+		r.resolveExpression(node.Condition)
+		r.resolveBlock(node.Consequence)
+		r.resolveBlock(node.Alternative)
+	case *ast.FunctionLiteral:
+		r.scope.functions = append(r.scope.functions, function{node, false})
+	case *ast.CallExpression:
+		r.resolveExpression(node.Function)
+		r.resolveExpressions(node.Arguments)
+	case *ast.ArrayLiteral:
+		r.resolveExpressions(node.Elements)
+	case *ast.SetLiteral:
+		r.resolveExpressions(node.Elements)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			r.resolveExpression(pair.Key)
+			r.resolveExpression(pair.Value)
+		}
+	case *ast.IndexExpression:
+		r.resolveExpression(node.Left)
+		r.resolveExpression(node.Index)
+	case *ast.SliceExpression:
+		r.resolveExpressions([]ast.Expression{node.Left, node.Start, node.End, node.Step})
+	case *ast.DotExpression:
+		// the right side names a member, not a variable
+		r.resolveExpression(node.Left)
+	}
+}
+
+func (r *Resolver) resolveExpressions(expressions []ast.Expression) {
+	for _, exp := range expressions {
+		r.resolveExpression(exp)
+	}
+}
+
+// resolveFunctions resolves the functions declared in the current scope,
+// which has declared all of its variables by now
+func (r *Resolver) resolveFunctions() {
+	for len(r.scope.functions) > 0 {
+		fn := r.scope.functions[0]
+		r.scope.functions = r.scope.functions[1:]
+		r.resolveFunction(fn.literal, fn.method)
+	}
+}
+
+// resolveFunction resolves fn in a scope of its own. Methods receive self in
+// their first slot.
+func (r *Resolver) resolveFunction(fn *ast.FunctionLiteral, method bool) {
+	r.scope = &scope{outer: r.scope, fn: fn, slots: map[string]int{}, locals: []string{}}
+	if method {
+		r.scope.define("self")
+	}
+	for _, param := range fn.Parameters {
+		param.Binding = &ast.Binding{Slot: r.scope.define(param.Value)}
+	}
+
+	r.resolveBlock(fn.Body)
+	r.resolveFunctions()
+
+	fn.Locals = r.scope.locals
+	r.scope = r.scope.outer
+}
+
+// declare binds the variable declared by a let, struct or import statement
+func (r *Resolver) declare(ident *ast.Identifier) {
+	block := r.blocks[len(r.blocks)-1]
+	if block[ident.Value] {
+		r.errorf("identifier %s is already declared", ident.Value)
+	}
+	block[ident.Value] = true
+
+	if r.scope.fn == nil {
+		r.globals[ident.Value] = true
+		ident.Binding = nil
+		return
+	}
+	ident.Binding = &ast.Binding{Slot: r.scope.define(ident.Value)}
+}
+
+// bind looks up the variable named by ident, reporting false when there is
+// none. Globals are looked up by name when the program runs, so they are
+// left without a binding.
+func (r *Resolver) bind(ident *ast.Identifier) bool {
+	depth := 0
+	for s := r.scope; s.fn != nil; s = s.outer {
+		if slot, ok := s.slots[ident.Value]; ok {
+			ident.Binding = &ast.Binding{Depth: depth, Slot: slot}
+			return true
+		}
+		depth++
+	}
+
+	ident.Binding = nil
+	return r.globals[ident.Value] || r.defined(ident.Value)
+}
+
+// define gives name a slot in the scope, keeping the one of an earlier
+// declaration as the evaluator overwrites the variable
+func (s *scope) define(name string) int {
+	if slot, ok := s.slots[name]; ok {
+		return slot
+	}
+	s.slots[name] = len(s.locals)
+	s.locals = append(s.locals, name)
+	return s.slots[name]
+}
+
+func (r *Resolver) enterBlock() {
+	r.blocks = append(r.blocks, map[string]bool{})
+}
+
+func (r *Resolver) leaveBlock() {
+	r.blocks = r.blocks[:len(r.blocks)-1]
+}
+
+func (r *Resolver) errorf(format string, a ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, a...))
+}
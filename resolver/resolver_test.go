@@ -0,0 +1,160 @@
+package resolver
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestBindings(t *testing.T) {
+	input := `
+	let a = 1;
+	let f = fn(x, y) {
+		let z = x;
+		fn(w) { a + x + z + w }
+	};
+	`
+	program := parse(t, input)
+	if errors := New(builtins("len")).Resolve(program); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+
+	outer := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	testLocals(t, outer, "x", "y", "z")
+
+	let := outer.Body.Statements[0].(*ast.LetStatement)
+	testBinding(t, let.Name, &ast.Binding{Depth: 0, Slot: 2})
+	testBinding(t, let.Value.(*ast.Identifier), &ast.Binding{Depth: 0, Slot: 0})
+
+	inner := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	testLocals(t, inner, "w")
+
+	// ((a + x) + z) + w
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	testBinding(t, sum.Right.(*ast.Identifier), &ast.Binding{Depth: 0, Slot: 0})
+	sum = sum.Left.(*ast.InfixExpression)
+	testBinding(t, sum.Right.(*ast.Identifier), &ast.Binding{Depth: 1, Slot: 2})
+	sum = sum.Left.(*ast.InfixExpression)
+	testBinding(t, sum.Right.(*ast.Identifier), &ast.Binding{Depth: 1, Slot: 0})
+	testBinding(t, sum.Left.(*ast.Identifier), nil)
+}
+
+func TestMethodsBindSelfFirst(t *testing.T) {
+	program := parse(t, "struct Point { x, y; fn scale(k) { let p = self; k } }")
+	if errors := New(builtins()).Resolve(program); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+
+	method := program.Statements[0].(*ast.StructStatement).Methods[0].Function
+	testLocals(t, method, "self", "k", "p")
+}
+
+func TestBlocksShareTheirFunctionScope(t *testing.T) {
+	program := parse(t, "fn(a) { if (a) { let b = 1 } else { let b = 2 }; b }")
+	if errors := New(builtins()).Resolve(program); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	testLocals(t, fn, "a", "b")
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 1; len(a)", nil},
+		{"foobar", []string{"identifier foobar is undefined"}},
+		{"a; let a = 1", []string{"identifier a is undefined"}},
+		{"let f = fn() { a }; let a = 1", nil},
+		{"let f = fn() { let g = fn() { b }; let b = 1 }", nil},
+		{"let f = fn(x) { x }; x", []string{"identifier x is undefined"}},
+		{"b = 1", []string{"assign to an undefined identifier b"}},
+		{"let b = 1; fn() { b = 2 }", nil},
+		{"let a = 1; let a = 2", []string{"identifier a is already declared"}},
+		{"let a = 1; if (a) { let a = 2 }", nil},
+		{"fn(a) { let a = a }", nil},
+		{"struct A { x } let A = 1", []string{"identifier A is already declared"}},
+		{`import "a.m" as a; let a = 1`, []string{"identifier a is already declared"}},
+		{"fn() { self }", []string{"identifier self is undefined"}},
+		{"let h = {}; h.missing", nil},
+		{"[1][nope:]", []string{"identifier nope is undefined"}},
+	}
+
+	for _, tt := range tests {
+		errors := New(builtins("len")).Resolve(parse(t, tt.input))
+		if strings.Join(errors, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: wrong errors. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestGlobalsOutliveAProgram(t *testing.T) {
+	r := New(builtins())
+
+	lines := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 1", nil},
+		{"a + b", []string{"identifier b is undefined"}},
+		{"let c = d", []string{"identifier d is undefined"}},
+		{"c", []string{"identifier c is undefined"}},
+		{"let a = 2", nil},
+		{"let b = fn() { a }", nil},
+		{"b()", nil},
+	}
+
+	for _, line := range lines {
+		errors := r.Resolve(parse(t, line.input))
+		if strings.Join(errors, "\n") != strings.Join(line.expected, "\n") {
+			t.Errorf("%s: wrong errors. want=%q, got=%q", line.input, line.expected, errors)
+		}
+	}
+}
+
+func builtins(names ...string) func(string) bool {
+	return func(name string) bool {
+		for _, builtin := range names {
+			if name == builtin {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser has errors: %v", errors)
+	}
+	return program
+}
+
+func testLocals(t *testing.T, fn *ast.FunctionLiteral, expected ...string) {
+	t.Helper()
+
+	if strings.Join(fn.Locals, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("wrong locals. want=%v, got=%v", expected, fn.Locals)
+	}
+}
+
+func testBinding(t *testing.T, ident *ast.Identifier, expected *ast.Binding) {
+	t.Helper()
+
+	switch {
+	case expected == nil && ident.Binding != nil:
+		t.Errorf("%s should be global, got=%+v", ident.Value, *ident.Binding)
+	case expected != nil && ident.Binding == nil:
+		t.Errorf("%s should be bound to %+v, got global", ident.Value, *expected)
+	case expected != nil && *ident.Binding != *expected:
+		t.Errorf("%s bound wrong. want=%+v, got=%+v", ident.Value, *expected, *ident.Binding)
+	}
+}
@@ -6,11 +6,17 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// Line and Column locate the first character of the token in the source,
+	// counting from 1. Columns count bytes.
+	Line   int
+	Column int
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // never returned by the lexer, see Lexer.Comments
 
 	// Identifiers + literals
 	IDENT = "IDENT"
@@ -31,6 +37,9 @@ const (
 	DECREMENT = "--"
 	INCREMENT = "++"
 
+	PIPE      = "|"
+	AMPERSAND = "&"
+
 	LT    = "<"
 	GT    = ">"
 	EQ    = "=="
@@ -42,12 +51,13 @@ const (
 	COLON     = ":"
 	DOT       = "."
 
-	LPAREN   = "("
-	RPAREN   = ")"
-	LBRACE   = "{"
-	RBRACE   = "}"
-	LBRACKET = "["
-	RBRACKET = "]"
+	LPAREN    = "("
+	RPAREN    = ")"
+	LBRACE    = "{"
+	RBRACE    = "}"
+	HASHBRACE = "#{"
+	LBRACKET  = "["
+	RBRACKET  = "]"
 
 	// Literals
 	STRING = "STRING"
@@ -60,6 +70,12 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IN       = "IN"
+	NOT      = "NOT"
+	STRUCT   = "STRUCT"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
 )
 
 var keywords = map[string]TokenType{
@@ -70,6 +86,12 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"in":     IN,
+	"not":    NOT,
+	"struct": STRUCT,
+	"import": IMPORT,
+	"export": EXPORT,
+	"as":     AS,
 }
 
 func LookupIdent(ident string) TokenType {
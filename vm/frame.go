@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+// Scope holds the locals of a function call. Scopes live on the heap and
+// point to the scope the function was created in, so closures keep sharing,
+// and assigning, the variables of the functions enclosing them.
+type Scope struct {
+	fn     *compiler.CompiledFunction
+	values []object.Object
+	outer  *Scope
+}
+
+// outerAt returns the scope depth levels out from s
+func (s *Scope) outerAt(depth int) *Scope {
+	scope := s
+	for ; depth > 0; depth-- {
+		scope = scope.outer
+	}
+	return scope
+}
+
+// Closure is a compiled function along with the scope it was created in
+type Closure struct {
+	Fn    *compiler.CompiledFunction
+	Scope *Scope
+
+	vm *VM // the machine that created the closure, which runs it for builtins
+}
+
+func (c *Closure) Type() object.ObjectType { return object.FunctionType }
+func (c *Closure) Inspect() string         { return c.Fn.Inspect() }
+
+// Call runs the closure for builtins taking functions, such as map
+func (c *Closure) Call(env *object.Environment, args []object.Object) object.Object {
+	return c.vm.invoke(c, args)
+}
+
+// Frame is a call being executed
+type Frame struct {
+	cl    *Closure
+	ip    int
+	scope *Scope
+	base  int // position of the callee on the stack, where its result goes
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,546 @@
+// Package vm executes the bytecode produced by the compiler on a stack-based
+// virtual machine. Operators, builtins and modules go through the evaluator
+// so both backends share the same semantics.
+package vm
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"strings"
+)
+
+const initialStackSize = 256
+
+var (
+	NULL  = evaluator.NULL
+	TRUE  = evaluator.TRUE
+	FALSE = evaluator.FALSE
+)
+
+// infixOperators maps the operator instructions back to the operators of the
+// evaluator
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpLessThan:    "<",
+	code.OpGreaterThan: ">",
+	code.OpIn:          "in",
+	code.OpNotIn:       "not in",
+	code.OpUnion:       "|",
+	code.OpIntersect:   "&",
+}
+
+// Globals holds the values of the global variables, by the slots given by the
+// compiler. The REPL keeps the same globals for every line.
+type Globals struct {
+	names  []string
+	values []object.Object
+}
+
+func NewGlobals() *Globals {
+	return &Globals{}
+}
+
+// update makes room for the globals known to the compiler
+func (g *Globals) update(names []string) {
+	g.names = names
+	if len(names) > len(g.values) {
+		values := make([]object.Object, len(names))
+		copy(values, g.values)
+		g.values = values
+	}
+}
+
+type VM struct {
+	constants []object.Object
+	globals   *Globals
+
+	// env gives builtins and imports access to the registry, streams,
+	// options and module cache of the interpreter
+	env *object.Environment
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top being stack[sp-1]
+
+	frames []*Frame
+
+	lastPopped object.Object
+}
+
+func New(bytecode *compiler.Bytecode, env *object.Environment) *VM {
+	return NewWithGlobals(bytecode, env, NewGlobals())
+}
+
+func NewWithGlobals(bytecode *compiler.Bytecode, env *object.Environment, globals *Globals) *VM {
+	globals.update(bytecode.Globals)
+
+	main := &Closure{Fn: &compiler.CompiledFunction{Instructions: bytecode.Instructions}}
+	vm := &VM{
+		constants: bytecode.Constants,
+		globals:   globals,
+		env:       env,
+		stack:     make([]object.Object, initialStackSize),
+		frames:    []*Frame{{cl: main}},
+	}
+	main.vm = vm
+	return vm
+}
+
+// Eval compiles program and runs it on a new virtual machine
+func Eval(program *ast.Program, env *object.Environment) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return New(comp.Bytecode(), env).Run()
+}
+
+// Run executes the program and returns the value of its last statement, or
+// the error that stopped it
+func (vm *VM) Run() object.Object {
+	result := vm.run(0)
+	if isError(result) {
+		vm.sp = 0
+		vm.frames = vm.frames[:1]
+	}
+	return result
+}
+
+// Exports returns the values of the exported globals of a module
+func (vm *VM) Exports(bytecode *compiler.Bytecode) map[string]object.Object {
+	members := map[string]object.Object{}
+	for _, name := range bytecode.Exports {
+		for i, global := range vm.globals.names {
+			if global == name && vm.globals.values[i] != nil {
+				members[name] = vm.globals.values[i]
+			}
+		}
+	}
+	return members
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+// run executes instructions until the frame at index floor returns, or the
+// main frame runs out of instructions
+func (vm *VM) run(floor int) object.Object {
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
+
+	for {
+		if frame.ip >= len(ins) {
+			// only the main frame lacks a final return
+			if vm.lastPopped == nil {
+				return NULL
+			}
+			return vm.lastPopped
+		}
+
+		op := code.Opcode(ins[frame.ip])
+		frame.ip++
+
+		var err object.Object
+		switch op {
+		case code.OpConstant:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			vm.push(vm.constants[index])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpNull:
+			vm.push(NULL)
+		case code.OpTrue:
+			vm.push(TRUE)
+		case code.OpFalse:
+			vm.push(FALSE)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual,
+			code.OpLessThan, code.OpGreaterThan, code.OpIn, code.OpNotIn, code.OpUnion, code.OpIntersect:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.push(vm.executeInfix(op, left, right))
+
+		case code.OpMinus:
+			operand := vm.pop()
+			if integer, ok := operand.(*object.Integer); ok {
+				vm.push(&object.Integer{Value: -integer.Value})
+			} else {
+				err = vm.push(evaluator.PrefixOperation("-", operand))
+			}
+
+		case code.OpBang:
+			vm.push(nativeBoolToBooleanObject(!evaluator.IsTruthy(vm.pop())))
+
+		case code.OpPrefix:
+			operator := vm.constants[code.ReadUint16(ins[frame.ip:])].(*object.String)
+			frame.ip += 2
+			err = vm.push(evaluator.PrefixOperation(operator.Value, vm.pop()))
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[frame.ip:]))
+
+		case code.OpJumpNotTruthy:
+			target := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = target
+			}
+
+		case code.OpGetGlobal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.push(vm.getGlobal(int(index)))
+
+		case code.OpSetGlobal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			vm.globals.values[index] = vm.pop()
+
+		case code.OpAssignGlobal:
+			index := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			if vm.globals.values[index] == nil {
+				err = assignError(vm.globals.names[index])
+				break
+			}
+			vm.globals.values[index] = vm.pop()
+
+		case code.OpGetLocal:
+			slot := ins[frame.ip]
+			frame.ip++
+			value := frame.scope.values[slot]
+			if value == nil {
+				err = undefinedError(frame.cl.Fn.Locals[slot])
+				break
+			}
+			vm.push(value)
+
+		case code.OpSetLocal:
+			slot := ins[frame.ip]
+			frame.ip++
+			frame.scope.values[slot] = vm.pop()
+
+		case code.OpAssignLocal:
+			slot := ins[frame.ip]
+			frame.ip++
+			if frame.scope.values[slot] == nil {
+				err = assignError(frame.cl.Fn.Locals[slot])
+				break
+			}
+			frame.scope.values[slot] = vm.pop()
+
+		case code.OpGetFree:
+			scope := frame.scope.outerAt(int(ins[frame.ip]))
+			slot := ins[frame.ip+1]
+			frame.ip += 2
+			value := scope.values[slot]
+			if value == nil {
+				err = undefinedError(scope.fn.Locals[slot])
+				break
+			}
+			vm.push(value)
+
+		case code.OpAssignFree:
+			scope := frame.scope.outerAt(int(ins[frame.ip]))
+			slot := ins[frame.ip+1]
+			frame.ip += 2
+			if scope.values[slot] == nil {
+				err = assignError(scope.fn.Locals[slot])
+				break
+			}
+			scope.values[slot] = vm.pop()
+
+		case code.OpArray:
+			count := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			vm.push(object.NewArray(vm.popN(count)))
+
+		case code.OpHash:
+			count := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			err = vm.push(evaluator.NewHash(vm.popN(2 * count)))
+
+		case code.OpSet:
+			count := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			err = vm.push(evaluator.NewSet(vm.popN(count)))
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.push(evaluator.IndexOperation(left, index, vm.env))
+
+		case code.OpSlice:
+			flags := int(ins[frame.ip])
+			frame.ip++
+			bounds := make([]object.Object, 3)
+			for i := 2; i >= 0; i-- {
+				if flags&(1<<i) != 0 {
+					bounds[i] = vm.pop()
+				}
+			}
+			left := vm.pop()
+			err = vm.push(evaluator.SliceOperation(left, bounds[0], bounds[1], bounds[2]))
+
+		case code.OpDot:
+			name := vm.constants[code.ReadUint16(ins[frame.ip:])].(*object.String)
+			frame.ip += 2
+			err = vm.push(evaluator.DotOperation(vm.pop(), name.Value, vm.env))
+
+		case code.OpCall:
+			argc := int(ins[frame.ip])
+			frame.ip++
+			if err = vm.call(argc); err != nil {
+				break
+			}
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
+
+		case code.OpReturnValue:
+			value := vm.pop()
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = frame.base
+			if len(vm.frames) == floor {
+				return value
+			}
+			vm.push(value)
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
+
+		case code.OpClosure:
+			fn := vm.constants[code.ReadUint16(ins[frame.ip:])].(*compiler.CompiledFunction)
+			frame.ip += 2
+			vm.push(&Closure{Fn: fn, Scope: frame.scope, vm: vm})
+
+		case code.OpStruct:
+			template := vm.constants[code.ReadUint16(ins[frame.ip:])].(*object.Struct)
+			frame.ip += 2
+			structObj := &object.Struct{
+				Name:    template.Name,
+				Fields:  template.Fields,
+				Methods: make(map[string]object.Object, len(template.Methods)),
+			}
+			for name, fn := range template.Methods {
+				fn := fn.(*compiler.CompiledFunction)
+				structObj.Methods[name] = &Closure{Fn: fn, Scope: frame.scope, vm: vm}
+			}
+			vm.push(structObj)
+
+		case code.OpImport:
+			path := vm.constants[code.ReadUint16(ins[frame.ip:])].(*object.String)
+			alias := vm.constants[code.ReadUint16(ins[frame.ip+2:])].(*object.String)
+			frame.ip += 4
+			err = vm.push(evaluator.ImportModule(path.Value, alias.Value, vm.env, runModule))
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			err = &object.Error{Message: fmt.Sprintf("unsupported instruction %v", def)}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (vm *VM) executeInfix(op code.Opcode, left, right object.Object) object.Object {
+	leftInt, ok := left.(*object.Integer)
+	rightInt, ok2 := right.(*object.Integer)
+	if ok && ok2 {
+		l, r := leftInt.Value, rightInt.Value
+		switch op {
+		case code.OpAdd:
+			return &object.Integer{Value: l + r}
+		case code.OpSub:
+			return &object.Integer{Value: l - r}
+		case code.OpMul:
+			return &object.Integer{Value: l * r}
+		case code.OpDiv:
+			if r != 0 {
+				return &object.Integer{Value: l / r}
+			}
+		case code.OpEqual:
+			return nativeBoolToBooleanObject(l == r)
+		case code.OpNotEqual:
+			return nativeBoolToBooleanObject(l != r)
+		case code.OpLessThan:
+			return nativeBoolToBooleanObject(l < r)
+		case code.OpGreaterThan:
+			return nativeBoolToBooleanObject(l > r)
+		}
+	}
+	return evaluator.InfixOperation(infixOperators[op], left, right)
+}
+
+func (vm *VM) getGlobal(index int) object.Object {
+	if value := vm.globals.values[index]; value != nil {
+		return value
+	}
+	name := vm.globals.names[index]
+	if builtin, ok := evaluator.LookupBuiltin(vm.env, name); ok {
+		return builtin
+	}
+	return undefinedError(name)
+}
+
+// call calls the function found below its argc arguments on the stack.
+// Closures get a frame of their own, anything else is applied right away.
+func (vm *VM) call(argc int) object.Object {
+	base := vm.sp - argc - 1
+	callee := vm.stack[base]
+	args := vm.stack[base+1 : vm.sp]
+
+	// closures of other machines, such as those of imported modules, refer to
+	// their own constants and globals so they run on their machine
+	switch callee := callee.(type) {
+	case *Closure:
+		if callee.vm == vm {
+			return vm.pushFrame(callee, args, base)
+		}
+	case *object.BoundMethod:
+		if method, ok := callee.Method.(*Closure); ok && method.vm == vm {
+			withSelf := append([]object.Object{callee.Receiver}, args...)
+			return vm.pushFrame(method, withSelf, base)
+		}
+	}
+
+	result := evaluator.ApplyFunction(vm.env, callee, append([]object.Object{}, args...))
+	vm.sp = base
+	return vm.push(result)
+}
+
+// pushFrame enters cl with its parameters bound to args. Missing arguments
+// are an error while extra ones are ignored, as in the evaluator.
+func (vm *VM) pushFrame(cl *Closure, args []object.Object, base int) object.Object {
+	fn := cl.Fn
+	if len(args) < len(fn.Parameters) {
+		return &object.Error{Message: "function call is missing parameters: " +
+			strings.Join(fn.Parameters[len(args):], ", ")}
+	}
+	// the main frame is not a call
+	if len(vm.frames) > evaluator.MaxCallDepth {
+		return &object.Error{Message: "stack overflow"}
+	}
+
+	scope := &Scope{fn: fn, values: make([]object.Object, len(fn.Locals)), outer: cl.Scope}
+	copy(scope.values, args[:len(fn.Parameters)])
+	vm.frames = append(vm.frames, &Frame{cl: cl, scope: scope, base: base})
+	vm.sp = base
+	return nil
+}
+
+// invoke runs cl to completion on top of whatever the machine is running,
+// which lets builtins call closures back
+func (vm *VM) invoke(cl *Closure, args []object.Object) object.Object {
+	floor := len(vm.frames)
+	base := vm.sp
+	vm.push(cl)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+
+	if err := vm.pushFrame(cl, args, base); err != nil {
+		vm.sp = base
+		return err
+	}
+	result := vm.run(floor)
+	if isError(result) {
+		vm.frames = vm.frames[:floor]
+		vm.sp = base
+	}
+	return result
+}
+
+func (vm *VM) push(obj object.Object) object.Object {
+	if isError(obj) {
+		return obj
+	}
+	if vm.sp >= len(vm.stack) {
+		stack := make([]object.Object, 2*len(vm.stack))
+		copy(stack, vm.stack)
+		vm.stack = stack
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// popN pops the top n elements into a new slice, keeping their order
+func (vm *VM) popN(n int) []object.Object {
+	elements := make([]object.Object, n)
+	copy(elements, vm.stack[vm.sp-n:vm.sp])
+	vm.sp -= n
+	return elements
+}
+
+// runModule is the evaluator.ModuleRunner of the virtual machine
+func runModule(program *ast.Program, env *object.Environment) (map[string]object.Object, *object.Error) {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, &object.Error{Message: err.Error()}
+	}
+	bytecode := comp.Bytecode()
+	machine := New(bytecode, env)
+	if result := machine.Run(); isError(result) {
+		return nil, result.(*object.Error)
+	}
+	return machine.Exports(bytecode), nil
+}
+
+func undefinedError(name string) *object.Error {
+	return &object.Error{Message: fmt.Sprintf("identifier %s is undefined", name)}
+}
+
+func assignError(name string) *object.Error {
+	return &object.Error{Message: fmt.Sprintf("assign to an undefined identifier %s", name)}
+}
+
+func nativeBoolToBooleanObject(value bool) *object.Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ErrorType
+}
+
+// Session compiles and runs programs one after the other, each one seeing the
+// globals defined by the previous ones, as the lines of the REPL do
+type Session struct {
+	symbols   *compiler.SymbolTable
+	constants []object.Object
+	globals   *Globals
+}
+
+func NewSession() *Session {
+	return &Session{symbols: compiler.NewSymbolTable(), globals: NewGlobals()}
+}
+
+func (s *Session) Eval(program *ast.Program, env *object.Environment) object.Object {
+	comp := compiler.NewWithState(s.symbols, s.constants)
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	bytecode := comp.Bytecode()
+	s.constants = bytecode.Constants
+	return NewWithGlobals(bytecode, env, s.globals).Run()
+}
@@ -0,0 +1,191 @@
+package vm
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"sync"
+	"testing"
+)
+
+func TestClosuresShareCapturedVariables(t *testing.T) {
+	input := `
+	let counter = fn() {
+		let count = 0;
+		let inc = fn() { count = count + 1 };
+		let get = fn() { count };
+		[inc, get]
+	};
+	let c = counter();
+	c[0](); c[0](); c[0]();
+	let other = counter();
+	other[0]();
+	[c[1](), other[1]()]
+	`
+	testInspect(t, input, "[3, 1]")
+}
+
+func TestBuiltinsCallingClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let offset = 10; map([1, 2, 3], fn(x) { x + offset })", "[11, 12, 13]"},
+		{"let total = 0; map([1, 2, 3], fn(x) { total = total + x }); total", "6"},
+		{"let twice = fn(f) { fn(x) { f(f(x)) } }; map([1, 2], twice(fn(x) { x * 3 }))", "[9, 18]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestMachinesShareBytecode(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`let h = {"a": 1, "b": 2}; h["a"] + h["b"]`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := New(bytecode, object.NewEnvironment()).Run(); result.Inspect() != "3" {
+				t.Errorf("wrong result. want=3, got=%s", result.Inspect())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", "identifier foobar is undefined"},
+		{"x = 1", "assign to an undefined identifier x"},
+		{"fn(a, b) { a }(1)", "function call is missing parameters: b"},
+		{"let f = fn() { f() }; f()", "stack overflow"},
+		{"1 + true; 2", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		result := Eval(parse(tt.input), object.NewEnvironment())
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%s: expected error, got=%T (%s)", tt.input, result, result.Inspect())
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	session := NewSession()
+	env := object.NewEnvironment()
+
+	lines := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 5;", "null"},
+		{"let add = fn(x) { x + a };", "null"},
+		{"add(1)", "6"},
+		{"a = 10; add(1)", "11"},
+		{"undefined", "ERROR: identifier undefined is undefined"},
+		{"let b = add(a); b", "20"},
+	}
+
+	for _, line := range lines {
+		result := session.Eval(parse(line.input), env)
+		if result.Inspect() != line.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", line.input, line.expected, result.Inspect())
+		}
+	}
+}
+
+const fibonacci = `
+let fibonacci = fn(x) {
+	if (x < 2) { return x; }
+	fibonacci(x - 1) + fibonacci(x - 2)
+};
+fibonacci(20);
+`
+
+func BenchmarkFibonacciEvaluator(b *testing.B) {
+	program := parse(fibonacci)
+	resolver.New(evaluator.Defined(object.NewEnvironment())).Resolve(program)
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkFibonacciUnresolvedEvaluator(b *testing.B) {
+	program := parse(fibonacci)
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	program := parse(fibonacci)
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
+	}
+}
+
+// pushBuild builds an array of 100000 integers one push at a time, and
+// hashBuild a hash of as many keys one pair at a time, as the evaluator
+// benchmarks do
+const (
+	pushBuild = "reduce([0] * 100000, [], fn(acc, x) { push(acc, len(acc)) })"
+	hashBuild = "reduce(" + pushBuild + ", {}, fn(acc, x) { acc + {x: x} })"
+)
+
+func BenchmarkPushBuildVM(b *testing.B) {
+	benchmarkVM(b, pushBuild)
+}
+
+func BenchmarkHashBuildVM(b *testing.B) {
+	benchmarkVM(b, hashBuild)
+}
+
+// benchmarkVM compiles input once and measures running it
+func benchmarkVM(b *testing.B, input string) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if result := New(bytecode, object.NewEnvironment()).Run(); isError(result) {
+			b.Fatalf("run failed: %s", result.Inspect())
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testInspect(t *testing.T, input string, expected string) {
+	t.Helper()
+
+	result := Eval(parse(input), object.NewEnvironment())
+	if result.Inspect() != expected {
+		t.Errorf("%s: wrong result. want=%q, got=%q", input, expected, result.Inspect())
+	}
+}